@@ -3,9 +3,15 @@ package main
 /*Stuff related to admin routes*/
 
 import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync/atomic"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -47,3 +53,87 @@ func (cfg *apiConfig) reset(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
+
+// requireAdmin checks the ADMIN_KEY sent as "Authorization: ApiKey <key>".
+// Admin endpoints are disabled entirely when no key is configured.
+func (cfg *apiConfig) requireAdmin(w http.ResponseWriter, req *http.Request) bool {
+	key, err := auth.GetAPIKey(req.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find API key", err)
+		return false
+	}
+	if cfg.adminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(cfg.adminKey)) != 1 {
+		respondWithError(w, http.StatusForbidden, "Forbidden", nil)
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) unlockUser(w http.ResponseWriter, req *http.Request) {
+	if !cfg.requireAdmin(w, req) {
+		return
+	}
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	_, err = cfg.db.UnlockUser(req.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlock user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) banUser(w http.ResponseWriter, req *http.Request) {
+	if !cfg.requireAdmin(w, req) {
+		return
+	}
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	// BanUser bumps the token version, which kills live access tokens.
+	_, err = cfg.db.BanUser(req.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't ban user", err)
+		return
+	}
+	err = cfg.db.RevokeAllSessionsForUser(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unbanUser(w http.ResponseWriter, req *http.Request) {
+	if !cfg.requireAdmin(w, req) {
+		return
+	}
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	_, err = cfg.db.UnbanUser(req.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unban user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,18 +3,141 @@ package main
 /*Stuff related to API routes*/
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"slices"
 	"time"
 
 	"example.com/username/bootdev-chirpy/internal/auth"
 	"example.com/username/bootdev-chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
 const (
 	defaultExpiresIn int = 3600
 )
 
+func (cfg *apiConfig) parseAccessToken(req *http.Request) (*auth.AccessClaims, error) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		return nil, err
+	}
+	return auth.ParseJWT(token, cfg.keys, func(userID uuid.UUID) (int32, error) {
+		return cfg.db.GetUserTokenVersion(req.Context(), userID)
+	})
+}
+
+// authenticate returns the user the request's bearer access token belongs
+// to. Only first-party tokens are accepted, so third-party clients and
+// personal access tokens can't reach account management endpoints.
+func (cfg *apiConfig) authenticate(req *http.Request) (uuid.UUID, error) {
+	if _, err := auth.GetAPIKey(req.Header); err == nil {
+		return uuid.Nil, errInsufficientScope
+	}
+	claims, err := cfg.parseAccessToken(req)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if claims.IsDelegated() {
+		return uuid.Nil, errInsufficientScope
+	}
+	return claims.UserID()
+}
+
+var errInsufficientScope = errors.New("token is missing a required scope")
+
+// authorize authenticates the request with a first-party access token,
+// which may do anything, or with an OAuth access token or personal access
+// token, either of which must have been granted scope.
+func (cfg *apiConfig) authorize(req *http.Request, scope auth.Scope) (uuid.UUID, error) {
+	key, err := auth.GetAPIKey(req.Header)
+	if err != nil {
+		claims, err := cfg.parseAccessToken(req)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if claims.IsDelegated() && !slices.Contains(claims.Scopes(), scope) {
+			return uuid.Nil, errInsufficientScope
+		}
+		return claims.UserID()
+	}
+	token, err := cfg.db.GetAPITokenByHash(req.Context(), auth.HashToken(key))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	scopes, err := auth.ParseScopes(token.Scopes)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !slices.Contains(scopes, scope) {
+		return uuid.Nil, errInsufficientScope
+	}
+	err = cfg.db.TouchAPIToken(req.Context(), token.ID)
+	if err != nil {
+		log.Printf("Couldn't update last use of API token %s: %v", token.ID, err)
+	}
+	return token.UserID, nil
+}
+
+// authorizeRead lets anonymous requests through, but a request that does
+// present a delegated token or personal access token needs scope.
+func (cfg *apiConfig) authorizeRead(req *http.Request, scope auth.Scope) error {
+	if req.Header.Get("Authorization") == "" {
+		return nil
+	}
+	_, err := cfg.authorize(req, scope)
+	return err
+}
+
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInsufficientScope) {
+		respondWithError(w, http.StatusForbidden, "Token lacks the required scope", err)
+		return
+	}
+	respondWithError(w, http.StatusUnauthorized, "Invalid Token Header!", err)
+}
+
+var errDelegatedSession = errors.New("delegated credentials can't start a session")
+
+// issueTokens mints an access token and a refresh token belonging to the
+// session identified by familyID. It refuses requests made with a personal
+// access token or a third-party access token, so a scoped credential can
+// never be turned into a first-party session.
+func (cfg *apiConfig) issueTokens(req *http.Request, user database.User, familyID uuid.UUID) (string, string, error) {
+	if _, err := auth.GetAPIKey(req.Header); err == nil {
+		return "", "", errDelegatedSession
+	}
+	if bearer, err := auth.GetBearerToken(req.Header); err == nil {
+		// Refresh requests carry an opaque refresh token here, which
+		// doesn't parse and is fine.
+		if claims, err := auth.ParseJWT(bearer, cfg.keys, nil); err == nil && claims.IsDelegated() {
+			return "", "", errDelegatedSession
+		}
+	}
+	token, err := auth.MakeJWT(user.ID, user.TokenVersion, cfg.keys, time.Duration(defaultExpiresIn)*time.Second)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	_, err = cfg.db.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(refreshToken),
+		FamilyID:  familyID,
+		UserAgent: req.UserAgent(),
+		Ip:        cfg.clientIP(req),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
 func (cfg *apiConfig) login(w http.ResponseWriter, req *http.Request) {
 	decoder := json.NewDecoder(req.Body)
 	params := parameters{}
@@ -27,45 +150,105 @@ func (cfg *apiConfig) login(w http.ResponseWriter, req *http.Request) {
 
 	user, err := cfg.db.GetUserByMail(req.Context(), params.Email)
 	if err != nil {
+		checkDummyPassword(params.Password)
+		cfg.loginFailed(req, nil)
 		w.WriteHeader(401)
 		w.Write([]byte("Incorrect email or password"))
 		return
 	}
 	err = auth.CheckPasswordHash(user.Password, params.Password)
-	if err != nil {
+	if err != nil || isLocked(user) {
+		// A locked account gets the same answer as a wrong password.
+		cfg.loginFailed(req, &user)
 		w.WriteHeader(401)
 		w.Write([]byte("Incorrect email or password"))
 		return
 	}
-	expiresIn := defaultExpiresIn
-	token, err := auth.MakeJWT(user.ID, cfg.secret, time.Duration(time.Duration(expiresIn)*time.Second))
+	if auth.NeedsRehash(user.Password) {
+		cfg.rehashPassword(req, user, params.Password)
+	}
+	// With 2FA on, the count only starts over once the code is right too,
+	// or knowing the password would allow endless guesses at codes.
+	if !user.TotpEnabledAt.Valid && (user.FailedLoginAttempts > 0 || user.LockedUntil.Valid) {
+		_, err = cfg.db.UnlockUser(req.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't reset login attempts", err)
+			return
+		}
+	}
+	if user.BannedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Account suspended", nil)
+		return
+	}
+	if cfg.verification == verifyToLogin && !user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Verify your email address before logging in", errEmailNotVerified)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		// The password was right, but tokens wait for the second factor.
+		challenge, err := auth.MakeChallengeJWT(user.ID, cfg.keys, challengeExpiresIn)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to generate token...", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, twoFactorChallenge{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+		})
+		return
+	}
+
+	cfg.completeLogin(w, req, user)
+}
+
+// rehashPassword upgrades a stored hash to the current algorithm and
+// parameters while the plaintext is at hand. Failing to is no reason to
+// refuse the login, since the old hash still works.
+func (cfg *apiConfig) rehashPassword(req *http.Request, user database.User, password string) {
+	hash, err := auth.HashPassword(password)
+	if err == nil {
+		err = cfg.db.RehashPassword(req.Context(), database.RehashPasswordParams{
+			ID:       user.ID,
+			Password: hash,
+		})
+	}
+	if err != nil {
+		log.Printf("Couldn't rehash password for user %s: %v", user.ID, err)
+	}
+}
+
+type twoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+// completeLogin starts a new session for a user who has passed every login
+// check.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, req *http.Request, user database.User) {
+	err := cfg.reactivate(req.Context(), user)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to generate token..."))
+		respondWithError(w, http.StatusInternalServerError, "Couldn't cancel account deletion", err)
 		return
 	}
-	refreshToken, err := auth.MakeRefreshToken()
+	red, err := cfg.isChirpyRed(req.Context(), user.ID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to generate token..."))
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get subscription", err)
 		return
 	}
-	_, err = cfg.db.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
-		UserID: user.ID,
-		Token:  refreshToken,
-	})
+	token, refreshToken, err := cfg.issueTokens(req, user, uuid.New())
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to save refresh token", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate token...", err)
 		return
 	}
 
-	user_struct := User{user.ID, user.CreatedAt, user.UpdatedAt, user.Email, token, refreshToken, user.IsChirpyRed.Bool}
+	user_struct := User{user.ID, user.CreatedAt, user.UpdatedAt, user.Email, token, refreshToken, red}
 	respondWithJSON(w, http.StatusOK, user_struct)
 }
 
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -74,27 +257,55 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByRefreshToken(r.Context(), refreshToken)
+	stored, err := cfg.db.GetRefreshToken(r.Context(), auth.HashToken(refreshToken))
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
 		return
 	}
+	if stored.RevokedAt.Valid {
+		// A rotated-out token is only ever presented again if it was copied,
+		// so treat it as stolen and end the whole session.
+		cfg.revokeTokenFamily(r, stored.FamilyID)
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", errors.New("refresh token reused"))
+		return
+	}
 
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.secret,
-		time.Hour,
-	)
+	user, err := cfg.db.GetUserByRefreshToken(r.Context(), auth.HashToken(refreshToken))
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
+		return
+	}
+
+	accessToken, newRefreshToken, err := cfg.issueTokens(r, user, stored.FamilyID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate token...", err)
+		return
+	}
+	_, err = cfg.db.RevokeRefreshToken(r.Context(), database.RevokeRefreshTokenParams{
+		TokenHash:      auth.HashToken(refreshToken),
+		ReplacedByHash: sql.NullString{String: auth.HashToken(newRefreshToken), Valid: true},
+	})
+	if err != nil {
+		// Someone else rotated this token between our read and now.
+		cfg.revokeTokenFamily(r, stored.FamilyID)
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
 	})
 }
 
+func (cfg *apiConfig) revokeTokenFamily(r *http.Request, familyID uuid.UUID) {
+	log.Printf("Refresh token reuse detected, revoking family %s", familyID)
+	err := cfg.db.RevokeRefreshTokenFamily(r.Context(), familyID)
+	if err != nil {
+		log.Printf("Couldn't revoke refresh token family %s: %v", familyID, err)
+	}
+}
+
 func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -102,8 +313,10 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = cfg.db.RevokeRefreshToken(r.Context(), refreshToken)
-	if err != nil {
+	_, err = cfg.db.RevokeRefreshToken(r.Context(), database.RevokeRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
 		return
 	}
@@ -36,6 +36,10 @@ func healthCheck(w http.ResponseWriter, req *http.Request) {
 }
 
 func (cfg *apiConfig) getChirp(w http.ResponseWriter, req *http.Request) {
+	if err := cfg.authorizeRead(req, auth.ScopeChirpsRead); err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
 	id := req.PathValue("chirpID")
 	fmt.Println(id)
 	uid, _ := uuid.Parse(id)
@@ -57,6 +61,10 @@ func (cfg *apiConfig) getChirp(w http.ResponseWriter, req *http.Request) {
 }
 
 func (cfg *apiConfig) getChirps(w http.ResponseWriter, req *http.Request) {
+	if err := cfg.authorizeRead(req, auth.ScopeChirpsRead); err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
 	a_id := req.URL.Query().Get("author_id")
 	sort_order := req.URL.Query().Get("sort")
 	if sort_order == "" {
@@ -78,16 +86,22 @@ func (cfg *apiConfig) getChirps(w http.ResponseWriter, req *http.Request) {
 		author_uuid, _ := uuid.Parse(a_id)
 		chirp_structs = filterChirpsByUserID(chirp_structs, author_uuid)
 	}
-	if sort_order == "desc" {
-		sort.Slice(chirp_structs, func(i, j int) bool {
-			return chirp_structs[i].CreatedAt.After(chirp_structs[j].CreatedAt)
+	sortChirps(chirp_structs, sort_order)
+	respondWithJSON(w, 200, chirp_structs)
+}
+
+// sortChirps orders chirps by creation time, newest first if order is
+// "desc" and oldest first otherwise.
+func sortChirps(chirps []Chirp, order string) {
+	if order == "desc" {
+		sort.Slice(chirps, func(i, j int) bool {
+			return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
 		})
 	} else {
-		sort.Slice(chirp_structs, func(i, j int) bool {
-			return chirp_structs[i].CreatedAt.Before(chirp_structs[j].CreatedAt)
+		sort.Slice(chirps, func(i, j int) bool {
+			return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
 		})
 	}
-	respondWithJSON(w, 200, chirp_structs)
 }
 
 func filterChirpsByUserID(chirps []Chirp, userID uuid.UUID) []Chirp {
@@ -110,21 +124,28 @@ func (cfg *apiConfig) createChirp(w http.ResponseWriter, req *http.Request) {
 		w.Write([]byte("Error decoding parameters"))
 		return
 	}
-	token, err := auth.GetBearerToken((req.Header))
+	userId, err := cfg.authorize(req, auth.ScopeChirpsWrite)
 	if err != nil {
-		w.WriteHeader(401)
-		w.Write([]byte("Invalid Token Header!"))
+		respondWithAuthError(w, err)
+		return
+	}
+	fmt.Println(userId)
+	err = cfg.requireVerifiedEmail(req.Context(), userId)
+	if errors.Is(err, errEmailNotVerified) {
+		respondWithError(w, http.StatusForbidden, "Verify your email address before posting", err)
 		return
 	}
-	userId, err := auth.ValidateJWT(token, cfg.secret)
 	if err != nil {
-		w.WriteHeader(401)
-		w.Write([]byte("Invalid Token Header!"))
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	ent, err := cfg.entitlementsFor(req.Context(), userId)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get entitlements", err)
 		return
 	}
-	fmt.Println(userId)
 
-	if len(params.Body) > 140 {
+	if len(params.Body) > ent.MaxChirpLength {
 		err_msg := "Chirp is too long"
 		respondWithError(w, 500, err_msg, errors.New(err_msg))
 	} else {
@@ -141,6 +162,67 @@ func (cfg *apiConfig) createChirp(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// editChirp replaces the body of one of the caller's chirps, for plans
+// that include edit rights.
+func (cfg *apiConfig) editChirp(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authorize(req, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+	ent, err := cfg.entitlementsFor(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get entitlements", err)
+		return
+	}
+	if !ent.EditChirps {
+		respondWithError(w, http.StatusForbidden, "Your plan doesn't include editing chirps", nil)
+		return
+	}
+
+	params := parameters{}
+	err = json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if len(params.Body) > ent.MaxChirpLength {
+		errs := fieldErrors{}
+		errs.add("body", fmt.Sprintf("must be at most %d bytes long", ent.MaxChirpLength))
+		respondWithFieldErrors(w, errs)
+		return
+	}
+
+	chirp, err := cfg.db.GetChirp(req.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp", err)
+		return
+	}
+	if chirp.UserID.UUID != userID {
+		respondWithError(w, http.StatusForbidden, "you do not own this Chirp", nil)
+		return
+	}
+	chirp, err = cfg.db.UpdateChirp(req.Context(), database.UpdateChirpParams{
+		ID:     chirpID,
+		UserID: uuid.NullUUID{UUID: userID, Valid: true},
+		Body:   sanitize(params.Body),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update chirp", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Chirp{chirp.ID, chirp.CreatedAt, chirp.UpdatedAt, chirp.Body, chirp.UserID.UUID})
+}
+
 func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, req *http.Request) {
 	id := req.PathValue("chirpID")
 	fmt.Println(id)
@@ -160,16 +242,9 @@ func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, req *http.Request) {
 	}
 	fmt.Println(chirp)
 
-	token, err := auth.GetBearerToken((req.Header))
-	if err != nil {
-		w.WriteHeader(401)
-		w.Write([]byte("Invalid Token Header!"))
-		return
-	}
-	userId, err := auth.ValidateJWT(token, cfg.secret)
+	userId, err := cfg.authorize(req, auth.ScopeChirpsWrite)
 	if err != nil {
-		w.WriteHeader(401)
-		w.Write([]byte("Invalid Token Header!"))
+		respondWithAuthError(w, err)
 		return
 	}
 
@@ -0,0 +1,168 @@
+package main
+
+/*Stuff related to users deleting their accounts*/
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/database"
+	"example.com/username/bootdev-chirpy/internal/mailer"
+)
+
+const (
+	defaultDeletionGrace = 30 * 24 * time.Hour
+	purgeInterval        = time.Hour
+)
+
+// loadDeletionGrace reads ACCOUNT_DELETION_GRACE, a Go duration like
+// "720h".
+func loadDeletionGrace() (time.Duration, error) {
+	s := os.Getenv("ACCOUNT_DELETION_GRACE")
+	if s == "" {
+		return defaultDeletionGrace, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid ACCOUNT_DELETION_GRACE %q", s)
+	}
+	return d, nil
+}
+
+// deleteMe deactivates the caller's account straight away and schedules it
+// for deletion once the grace period is over. Logging back in before then
+// cancels the deletion.
+func (cfg *apiConfig) deleteMe(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		DeactivatedAt time.Time `json:"deactivated_at"`
+		PurgeAfter    time.Time `json:"purge_after"`
+	}
+
+	params := twoFactorParameters{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters", err)
+		return
+	}
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	err = cfg.checkCurrentPassword(req, user, params.Password)
+	if errors.Is(err, errAccountLocked) {
+		respondWithError(w, http.StatusForbidden, "Account locked, try again later", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, "Incorrect password", err)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		err = cfg.checkSecondFactor(req, user, params)
+		if err != nil {
+			respondWithError(w, http.StatusForbidden, "Invalid code", err)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	// DeactivateUser bumps the token version, which kills live access
+	// tokens; refresh tokens are revoked below.
+	err = cfg.db.DeactivateUser(req.Context(), database.DeactivateUserParams{
+		ID:            user.ID,
+		DeactivatedAt: sql.NullTime{Time: now, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't deactivate account", err)
+		return
+	}
+	err = cfg.db.RevokeAllSessionsForUser(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	err = cfg.db.RevokeOAuthRefreshTokensForUser(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke app access", err)
+		return
+	}
+
+	purgeAfter := now.Add(cfg.deletionGrace)
+	cfg.sendMail(req.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy account will be deleted",
+		Body: fmt.Sprintf("Your Chirpy account has been deactivated and will be deleted for good after %s.\n\n"+
+			"Changed your mind? Log in before then and nothing will be deleted.\n", purgeAfter.Format(time.RFC1123)),
+	})
+	respondWithJSON(w, http.StatusAccepted, response{
+		DeactivatedAt: now,
+		PurgeAfter:    purgeAfter,
+	})
+}
+
+// reactivate cancels a pending deletion when its owner logs back in.
+func (cfg *apiConfig) reactivate(ctx context.Context, user database.User) error {
+	if !user.DeactivatedAt.Valid {
+		return nil
+	}
+	log.Printf("User %s logged in, cancelling account deletion", user.ID)
+	return cfg.db.ReactivateUser(ctx, user.ID)
+}
+
+// runPurges deletes accounts whose grace period is over and data exports
+// past their retention, and expires lapsed subscriptions, every
+// purgeInterval until ctx is done.
+func (cfg *apiConfig) runPurges(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		cfg.purgeDeactivatedUsers(ctx)
+		cfg.purgeExpiredExports(ctx)
+		cfg.expireSubscriptions(ctx)
+		cfg.purgeSpentChallenges(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDeactivatedUsers deletes each expired account separately, so one
+// failure doesn't hold up the rest. Chirps, sessions, tokens, 2FA recovery
+// codes and OAuth grants go with the user through ON DELETE CASCADE.
+func (cfg *apiConfig) purgeDeactivatedUsers(ctx context.Context) {
+	cutoff := sql.NullTime{Time: time.Now().UTC().Add(-cfg.deletionGrace), Valid: true}
+	ids, err := cfg.db.GetUsersToPurge(ctx, cutoff)
+	if err != nil {
+		log.Printf("Couldn't list accounts to purge: %v", err)
+		return
+	}
+	for _, id := range ids {
+		// The cutoff is checked again in case the user logged in since.
+		n, err := cfg.db.PurgeUser(ctx, database.PurgeUserParams{
+			ID:            id,
+			DeactivatedAt: cutoff,
+		})
+		if err != nil {
+			log.Printf("Couldn't purge user %s: %v", id, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("Purged deactivated user %s", id)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+/*Stuff related to exporting a user's data*/
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// exportRetention is how long an export, finished or not, is kept.
+	exportRetention = 7 * 24 * time.Hour
+	// exportLinkExpiresIn is how long each download link works. Fetching the
+	// export's status hands out a fresh one.
+	exportLinkExpiresIn = time.Hour
+	exportTimeout       = 5 * time.Minute
+)
+
+func (cfg *apiConfig) dataExportFromDB(row database.GetDataExportRow) DataExport {
+	export := DataExport{
+		ID:        row.ID,
+		Status:    row.Status,
+		CreatedAt: row.CreatedAt,
+	}
+	if row.CompletedAt.Valid {
+		export.CompletedAt = &row.CompletedAt.Time
+	}
+	if row.ExpiresAt.Valid {
+		export.ExpiresAt = &row.ExpiresAt.Time
+		if row.Status == "ready" && time.Now().UTC().Before(row.ExpiresAt.Time) {
+			export.DownloadURL = cfg.signExportURL(row.ID, time.Now().Add(exportLinkExpiresIn))
+		}
+	}
+	return export
+}
+
+// requestExport starts building an archive of everything stored about the
+// caller. It answers straight away; the client polls getExport until the
+// archive is ready.
+func (cfg *apiConfig) requestExport(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	// The row expires even if the export never finishes, say because the
+	// server restarted; completing it pushes the expiry back.
+	row, err := cfg.db.CreateDataExport(req.Context(), database.CreateDataExportParams{
+		UserID:    userID,
+		ExpiresAt: sql.NullTime{Time: time.Now().UTC().Add(exportRetention), Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start export", err)
+		return
+	}
+
+	go cfg.runExport(context.WithoutCancel(req.Context()), row.ID, userID)
+
+	w.Header().Set("Location", "/api/users/me/export/"+row.ID.String())
+	respondWithJSON(w, http.StatusAccepted, cfg.dataExportFromDB(database.GetDataExportRow(row)))
+}
+
+func (cfg *apiConfig) getExport(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	exportID, err := uuid.Parse(req.PathValue("exportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid export ID", err)
+		return
+	}
+	row, err := cfg.db.GetDataExport(req.Context(), database.GetDataExportParams{
+		ID:     exportID,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Export not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get export", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.dataExportFromDB(row))
+}
+
+// downloadExport serves an archive to anyone holding a valid signed link,
+// so it can be opened straight from a browser.
+func (cfg *apiConfig) downloadExport(w http.ResponseWriter, req *http.Request) {
+	exportID, err := uuid.Parse(req.PathValue("exportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid export ID", err)
+		return
+	}
+	query := req.URL.Query()
+	if !cfg.verifyExportURL(exportID, query.Get("expires"), query.Get("signature")) {
+		respondWithError(w, http.StatusForbidden, "Invalid or expired download link", nil)
+		return
+	}
+	archive, err := cfg.db.GetDataExportArchive(req.Context(), database.GetDataExportArchiveParams{
+		ID:        exportID,
+		ExpiresAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Export not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get export", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export-`+exportID.String()+`.zip"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(archive)
+}
+
+func (cfg *apiConfig) exportSignature(exportID uuid.UUID, expires string) []byte {
+	mac := hmac.New(sha256.New, []byte(cfg.secret))
+	mac.Write([]byte("data-export." + exportID.String() + "." + expires))
+	return mac.Sum(nil)
+}
+
+func (cfg *apiConfig) signExportURL(exportID uuid.UUID, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", exp)
+	query.Set("signature", hex.EncodeToString(cfg.exportSignature(exportID, exp)))
+	return cfg.baseURL + "/api/exports/" + exportID.String() + "/download?" + query.Encode()
+}
+
+func (cfg *apiConfig) verifyExportURL(exportID uuid.UUID, expires, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(sig, cfg.exportSignature(exportID, expires))
+}
+
+func (cfg *apiConfig) purgeExpiredExports(ctx context.Context) {
+	n, err := cfg.db.DeleteExpiredDataExports(ctx, sql.NullTime{Time: time.Now().UTC(), Valid: true})
+	if err != nil {
+		log.Printf("Couldn't delete expired data exports: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Deleted %d expired data exports", n)
+	}
+}
+
+func (cfg *apiConfig) runExport(ctx context.Context, exportID, userID uuid.UUID) {
+	buildCtx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	archive, err := cfg.buildExport(buildCtx, userID)
+	if err == nil {
+		err = cfg.db.CompleteDataExport(buildCtx, database.CompleteDataExportParams{
+			ID:        exportID,
+			Archive:   archive,
+			ExpiresAt: sql.NullTime{Time: time.Now().UTC().Add(exportRetention), Valid: true},
+		})
+	}
+	if err != nil {
+		log.Printf("Couldn't build export %s: %v", exportID, err)
+		// buildCtx may be what ran out, so the failure is recorded without it.
+		err = cfg.db.FailDataExport(ctx, database.FailDataExportParams{
+			ID:        exportID,
+			ExpiresAt: sql.NullTime{Time: time.Now().UTC().Add(exportRetention), Valid: true},
+		})
+		if err != nil {
+			log.Printf("Couldn't mark export %s as failed: %v", exportID, err)
+		}
+	}
+}
+
+// buildExport zips up one JSON file per kind of data held about the user.
+func (cfg *apiConfig) buildExport(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	type account struct {
+		User
+		Profile          Profile    `json:"profile"`
+		EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+		TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	}
+
+	user, err := cfg.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	red, err := cfg.isChirpyRed(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	acc := account{
+		User:             User{user.ID, user.CreatedAt, user.UpdatedAt, user.Email, "", "", red},
+		Profile:          profileFromDB(user, red),
+		TwoFactorEnabled: user.TotpEnabledAt.Valid,
+	}
+	if user.EmailVerifiedAt.Valid {
+		acc.EmailVerifiedAt = &user.EmailVerifiedAt.Time
+	}
+
+	chirps, err := cfg.db.GetChirpsByUser(ctx, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	chirp_structs := []Chirp{}
+	for _, chirp := range chirps {
+		chirp_structs = append(chirp_structs, Chirp{chirp.ID, chirp.CreatedAt, chirp.UpdatedAt, chirp.Body, chirp.UserID.UUID})
+	}
+
+	sessions, err := cfg.db.GetActiveSessionsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := cfg.db.GetAPITokensForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	apiTokens := []APIToken{}
+	for _, token := range tokens {
+		apiTokens = append(apiTokens, apiTokenFromDB(token))
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range []struct {
+		name string
+		data any
+	}{
+		{"account.json", acc},
+		{"chirps.json", chirp_structs},
+		{"sessions.json", sessionsFromDB(sessions)},
+		{"api_tokens.json", apiTokens},
+	} {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
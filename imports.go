@@ -0,0 +1,146 @@
+package main
+
+/*Stuff related to importing chirp archives*/
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"example.com/username/bootdev-chirpy/internal/database"
+	"example.com/username/bootdev-chirpy/internal/importer"
+	"github.com/google/uuid"
+)
+
+const (
+	maxImportSize = 50 << 20
+	// importProgressEvery is how many chirps go in between progress lines.
+	importProgressEvery = 100
+)
+
+type importProgress struct {
+	Imported int `json:"imported"`
+	Total    int `json:"total"`
+}
+
+type importReport struct {
+	Done      bool   `json:"done"`
+	Entries   int    `json:"entries"`
+	Imported  int    `json:"imported"`
+	Split     int    `json:"split"`
+	Truncated int    `json:"truncated"`
+	Skipped   int    `json:"skipped"`
+	Error     string `json:"error,omitempty"`
+}
+
+// importChirps adds the chirps in an uploaded archive to the caller's
+// account with their original timestamps. The archive is the request body;
+// ?format= is "tweets" or "jsonl" (detected if left out) and ?mode= is
+// "split" (the default) or "truncate" for entries over the length limit.
+//
+// The response is JSON Lines: progress lines while chirps are inserted,
+// then a report. Everything is inserted in one transaction, so if the
+// report has an error nothing was imported.
+func (cfg *apiConfig) importChirps(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authorize(req, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	err = cfg.requireVerifiedEmail(req.Context(), userID)
+	if errors.Is(err, errEmailNotVerified) {
+		respondWithError(w, http.StatusForbidden, "Verify your email address before posting", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	format := importer.Format(req.URL.Query().Get("format"))
+	mode := importer.Mode(req.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = importer.ModeSplit
+	}
+	if mode != importer.ModeSplit && mode != importer.ModeTruncate {
+		respondWithError(w, http.StatusBadRequest, "mode must be split or truncate", nil)
+		return
+	}
+	entries, err := importer.Parse(http.MaxBytesReader(w, req.Body, maxImportSize), format)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read archive: "+err.Error(), err)
+		return
+	}
+
+	ent, err := cfg.entitlementsFor(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get entitlements", err)
+		return
+	}
+
+	report := importReport{Entries: len(entries)}
+	chirps := []database.ImportChirpParams{}
+	for _, entry := range entries {
+		body := strings.TrimSpace(sanitize(entry.Body))
+		pieces := importer.Fit(body, ent.MaxChirpLength, mode)
+		if len(pieces) == 0 {
+			report.Skipped++
+			continue
+		}
+		if len(body) > ent.MaxChirpLength {
+			if mode == importer.ModeSplit {
+				report.Split++
+			} else {
+				report.Truncated++
+			}
+		}
+		for i, piece := range pieces {
+			chirps = append(chirps, database.ImportChirpParams{
+				// Later parts of a split entry sort after the first.
+				CreatedAt: entry.CreatedAt.Add(time.Duration(i) * time.Millisecond),
+				Body:      piece,
+				UserID:    uuid.NullUUID{UUID: userID, Valid: true},
+			})
+		}
+	}
+
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start import", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	for i, chirp := range chirps {
+		err = qtx.ImportChirp(req.Context(), chirp)
+		if err != nil {
+			break
+		}
+		if (i+1)%importProgressEvery == 0 {
+			enc.Encode(importProgress{Imported: i + 1, Total: len(chirps)})
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	report.Done = true
+	if err != nil {
+		log.Printf("Import for user %s failed: %v", userID, err)
+		report.Error = "Import failed, nothing was imported"
+	} else {
+		report.Imported = len(chirps)
+	}
+	enc.Encode(report)
+}
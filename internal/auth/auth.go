@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -11,7 +12,6 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type TokenType string
@@ -21,62 +21,110 @@ const (
 	TokenTypeAccess TokenType = "chirpy-access"
 )
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// AccessClaims are the claims carried by Chirpy access tokens.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	// TokenVersion must match the user's current token version; bumping it
+	// invalidates every outstanding access token for that user.
+	TokenVersion int32 `json:"ver"`
+	// ClientID and Scope are only set on tokens issued to third-party OAuth
+	// clients. First-party tokens are not limited to any scope.
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+// UserID returns the user the token was issued to.
+func (c *AccessClaims) UserID() (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Subject)
 	if err != nil {
-		return "", err
+		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
 	}
-	fmt.Println(string(bytes))
-	return string(bytes), err
+	return id, nil
 }
 
-func CheckPasswordHash(hash, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+// IsDelegated reports whether the token was issued to a third-party client.
+func (c *AccessClaims) IsDelegated() bool {
+	return c.ClientID != ""
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer:    string(TokenTypeAccess),
-		Subject:   userID.String(),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, _ := token.SignedString([]byte(tokenSecret))
+// Scopes returns the scopes granted to a delegated token.
+func (c *AccessClaims) Scopes() []Scope {
+	scopes, _ := ParseScopes(c.Scope)
+	return scopes
+}
 
-	return tokenString, nil
+// TokenVersionFunc looks up the current token version of a user.
+type TokenVersionFunc func(userID uuid.UUID) (int32, error)
+
+// ErrTokenRevoked is returned for tokens issued before the user's token
+// version was last bumped.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+func MakeJWT(userID uuid.UUID, tokenVersion int32, keys *KeyRing, expiresIn time.Duration) (string, error) {
+	return keys.sign(newAccessClaims(userID, tokenVersion, expiresIn))
 }
 
-// ValidateJWT -
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claimsStruct := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&claimsStruct,
-		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
-	)
-	if err != nil {
-		return uuid.Nil, err
+// MakeClientJWT issues an access token that an OAuth client can use on
+// behalf of a user, limited to scopes.
+func MakeClientJWT(userID uuid.UUID, tokenVersion int32, clientID uuid.UUID, scopes []Scope, keys *KeyRing, expiresIn time.Duration) (string, error) {
+	claims := newAccessClaims(userID, tokenVersion, expiresIn)
+	claims.ClientID = clientID.String()
+	claims.Scope = FormatScopes(scopes)
+	return keys.sign(claims)
+}
+
+func newAccessClaims(userID uuid.UUID, tokenVersion int32, expiresIn time.Duration) AccessClaims {
+	return AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeAccess),
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		},
+		TokenVersion: tokenVersion,
 	}
+}
 
-	userIDString, err := token.Claims.GetSubject()
+// ValidateJWT checks an access token and returns the user it belongs to.
+// See ParseJWT.
+func ValidateJWT(tokenString string, keys *KeyRing, currentVersion TokenVersionFunc) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, keys, currentVersion)
 	if err != nil {
 		return uuid.Nil, err
 	}
+	return claims.UserID()
+}
 
-	issuer, err := token.Claims.GetIssuer()
+// ParseJWT checks the signature and issuer of an access token and, unless
+// currentVersion is nil, that it hasn't been revoked since it was issued.
+func ParseJWT(tokenString string, keys *KeyRing, currentVersion TokenVersionFunc) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		keys.keyFunc,
+		jwt.WithValidMethods(validMethods),
+		jwt.WithIssuer(string(TokenTypeAccess)),
+	)
 	if err != nil {
-		return uuid.Nil, err
-	}
-	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+		return nil, err
 	}
 
-	id, err := uuid.Parse(userIDString)
+	id, err := claims.UserID()
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+		return nil, err
 	}
-	return id, nil
+
+	if currentVersion != nil {
+		version, err := currentVersion(id)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't check token version: %w", err)
+		}
+		if version != claims.TokenVersion {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -107,3 +155,11 @@ func MakeRefreshToken() (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+// HashToken returns the hex-encoded SHA-256 digest of an opaque token. Tokens
+// are high-entropy random strings, so an unsalted fast hash is enough to keep
+// a database leak from handing out working credentials.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -64,41 +64,70 @@ func TestCheckPasswordHash(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	keys := newTestKeyRing(t, "key-1")
+	otherKeys := newTestKeyRing(t, "key-1")
+	validToken, _ := MakeJWT(userID, 2, keys, time.Hour)
+	staleToken, _ := MakeJWT(userID, 1, keys, time.Hour)
+	expiredToken, _ := MakeJWT(userID, 2, keys, -time.Minute)
+	currentVersion := func(id uuid.UUID) (int32, error) { return 2, nil }
 
 	tests := []struct {
-		name        string
-		tokenString string
-		tokenSecret string
-		wantUserID  uuid.UUID
-		wantErr     bool
+		name           string
+		tokenString    string
+		keys           *KeyRing
+		currentVersion TokenVersionFunc
+		wantUserID     uuid.UUID
+		wantErr        bool
 	}{
 		{
 			name:        "Valid token",
 			tokenString: validToken,
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserID:  userID,
 			wantErr:     false,
 		},
 		{
 			name:        "Invalid token",
 			tokenString: "invalid.token.string",
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
 		{
-			name:        "Wrong secret",
+			name:        "Wrong key",
 			tokenString: validToken,
-			tokenSecret: "wrong_secret",
+			keys:        otherKeys,
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
+		{
+			name:        "Expired token",
+			tokenString: expiredToken,
+			keys:        keys,
+			wantUserID:  uuid.Nil,
+			wantErr:     true,
+		},
+		{
+			name:           "Current version",
+			tokenString:    validToken,
+			keys:           keys,
+			currentVersion: currentVersion,
+			wantUserID:     userID,
+			wantErr:        false,
+		},
+		{
+			name:           "Stale version",
+			tokenString:    staleToken,
+			keys:           keys,
+			currentVersion: currentVersion,
+			wantUserID:     uuid.Nil,
+			wantErr:        true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			gotUserID, err := ValidateJWT(tt.tokenString, tt.keys, tt.currentVersion)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -109,3 +138,24 @@ func TestValidateJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestHashToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("MakeRefreshToken() error = %v", err)
+	}
+	hash := HashToken(token)
+	if hash == token {
+		t.Error("HashToken() returned the token unchanged")
+	}
+	if len(hash) != 64 {
+		t.Errorf("HashToken() length = %d, want 64", len(hash))
+	}
+	if HashToken(token) != hash {
+		t.Error("HashToken() is not deterministic")
+	}
+	// SHA-256 of the empty string.
+	if got := HashToken(""); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("HashToken(\"\") = %s", got)
+	}
+}
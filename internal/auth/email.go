@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// TokenTypeEmailVerification is the issuer of tokens mailed out to prove a
+// user controls an email address.
+const TokenTypeEmailVerification TokenType = "chirpy-email-verification"
+
+// EmailClaims binds a verification token to the address it was sent to, so
+// it stops working if the user's email changes in the meantime.
+type EmailClaims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email"`
+}
+
+// MakeEmailJWT issues a token proving whoever holds it received mail at
+// email.
+func MakeEmailJWT(userID uuid.UUID, email string, keys *KeyRing, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	return keys.sign(EmailClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeEmailVerification),
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		},
+		Email: email,
+	})
+}
+
+// ValidateEmailJWT returns the user and address an email token was issued
+// for.
+func ValidateEmailJWT(tokenString string, keys *KeyRing) (uuid.UUID, string, error) {
+	claims := EmailClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&claims,
+		keys.keyFunc,
+		jwt.WithValidMethods(validMethods),
+		jwt.WithIssuer(string(TokenTypeEmailVerification)),
+	)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	if claims.Email == "" {
+		return uuid.Nil, "", errors.New("token has no email")
+	}
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("invalid user ID: %w", err)
+	}
+	return id, claims.Email, nil
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEmailJWT(t *testing.T) {
+	keys := newTestKeyRing(t, "key-1")
+	userID := uuid.New()
+
+	token, err := MakeEmailJWT(userID, "user@example.com", keys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeEmailJWT() error = %v", err)
+	}
+	gotID, gotEmail, err := ValidateEmailJWT(token, keys)
+	if err != nil || gotID != userID || gotEmail != "user@example.com" {
+		t.Errorf("ValidateEmailJWT() = %v, %q, %v, want %v, %q", gotID, gotEmail, err, userID, "user@example.com")
+	}
+	if _, err := ValidateJWT(token, keys, nil); err == nil {
+		t.Error("email token was accepted as an access token")
+	}
+
+	expired, _ := MakeEmailJWT(userID, "user@example.com", keys, -time.Minute)
+	if _, _, err := ValidateEmailJWT(expired, keys); err == nil {
+		t.Error("expired email token was accepted")
+	}
+
+	access, _ := MakeJWT(userID, 0, keys, time.Hour)
+	if _, _, err := ValidateEmailJWT(access, keys); err == nil {
+		t.Error("access token was accepted as an email token")
+	}
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSAKeyBits = 2048
+
+// Key is an asymmetric JWT signing key identified by its kid.
+type Key struct {
+	ID      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+// NewKey wraps an Ed25519 or RSA private key.
+func NewKey(id string, private crypto.Signer) (*Key, error) {
+	if id == "" {
+		return nil, errors.New("key ID is required")
+	}
+	switch k := private.(type) {
+	case ed25519.PrivateKey:
+		return &Key{ID: id, method: jwt.SigningMethodEdDSA, private: k}, nil
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key %s is %d bits, need at least %d", id, k.N.BitLen(), minRSAKeyBits)
+		}
+		return &Key{ID: id, method: jwt.SigningMethodRS256, private: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T for key %s", private, id)
+	}
+}
+
+// GenerateEd25519Key creates a fresh Ed25519 key.
+func GenerateEd25519Key(id string) (*Key, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(id, private)
+}
+
+// ParsePrivateKeyPEM reads a PKCS #8 Ed25519 or RSA key, or a PKCS #1 RSA
+// key, from PEM.
+func ParsePrivateKeyPEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found for key %s", id)
+	}
+	var private any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q for key %s", block.Type, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse key %s: %w", id, err)
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T for key %s", private, id)
+	}
+	return NewKey(id, signer)
+}
+
+// KeyRing holds every key that access tokens may be verified with, and the
+// single key new tokens are signed with. Keeping retired keys in the ring
+// lets tokens they signed live out their lifetime during a rotation.
+type KeyRing struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeyRing returns a ring that signs with signing and also accepts tokens
+// signed by any of the verification-only keys.
+func NewKeyRing(signing *Key, others ...*Key) *KeyRing {
+	ring := &KeyRing{
+		signing: signing,
+		keys:    map[string]*Key{signing.ID: signing},
+	}
+	for _, k := range others {
+		ring.keys[k.ID] = k
+	}
+	return ring
+}
+
+// LoadKeyRing reads every *.pem file in dir, using the file name without its
+// extension as the kid, and signs with the key named signingID.
+func LoadKeyRing(dir, signingID string) (*KeyRing, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	var signing *Key
+	var others []*Key
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParsePrivateKeyPEM(id, data)
+		if err != nil {
+			return nil, err
+		}
+		if id == signingID {
+			signing = key
+		} else {
+			others = append(others, key)
+		}
+	}
+	if signing == nil {
+		return nil, fmt.Errorf("signing key %q not found in %s", signingID, dir)
+	}
+	return NewKeyRing(signing, others...), nil
+}
+
+func (r *KeyRing) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(r.signing.method, claims)
+	token.Header["kid"] = r.signing.ID
+	return token.SignedString(r.signing.private)
+}
+
+// keyFunc resolves the verification key from the token's kid header and
+// makes sure the token was signed with the algorithm that key belongs to.
+func (r *KeyRing) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := r.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+	}
+	return key.private.Public(), nil
+}
+
+var validMethods = []string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}
+
+// JWK is the public half of a Key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the ring, sorted by kid.
+func (r *KeyRing) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range r.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.private.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestKey(t *testing.T, id string) *Key {
+	t.Helper()
+	key, err := GenerateEd25519Key(id)
+	if err != nil {
+		t.Fatalf("GenerateEd25519Key() error = %v", err)
+	}
+	return key
+}
+
+func newTestKeyRing(t *testing.T, id string) *KeyRing {
+	t.Helper()
+	return NewKeyRing(newTestKey(t, id))
+}
+
+func TestKeyRotation(t *testing.T) {
+	userID := uuid.New()
+	oldKey := newTestKey(t, "old")
+	newKey := newTestKey(t, "new")
+
+	oldToken, err := MakeJWT(userID, 0, NewKeyRing(oldKey), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	rotated := NewKeyRing(newKey, oldKey)
+	if _, err := ValidateJWT(oldToken, rotated, nil); err != nil {
+		t.Errorf("token signed by retired key rejected during rotation: %v", err)
+	}
+	newToken, _ := MakeJWT(userID, 0, rotated, time.Hour)
+	if _, err := ValidateJWT(newToken, rotated, nil); err != nil {
+		t.Errorf("token signed by active key rejected: %v", err)
+	}
+
+	retired := NewKeyRing(newKey)
+	if _, err := ValidateJWT(oldToken, retired, nil); err == nil {
+		t.Error("token signed by removed key was accepted")
+	}
+}
+
+func TestRS256(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	key, err := NewKey("rsa", private)
+	if err != nil {
+		t.Fatalf("NewKey() error = %v", err)
+	}
+	keys := NewKeyRing(key)
+	userID := uuid.New()
+	token, _ := MakeJWT(userID, 0, keys, time.Hour)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &AccessClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified() error = %v", err)
+	}
+	if parsed.Method.Alg() != "RS256" || parsed.Header["kid"] != "rsa" {
+		t.Errorf("header = %v, want RS256 signed with kid rsa", parsed.Header)
+	}
+	got, err := ValidateJWT(token, keys, nil)
+	if err != nil || got != userID {
+		t.Errorf("ValidateJWT() = %v, %v, want %v", got, err, userID)
+	}
+}
+
+func TestRejectsHS256(t *testing.T) {
+	claims := jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		Subject:   uuid.New().String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = "key-1"
+	signed, _ := token.SignedString([]byte("secret"))
+
+	if _, err := ValidateJWT(signed, newTestKeyRing(t, "key-1"), nil); err == nil {
+		t.Error("HS256 token was accepted")
+	}
+}
+
+func TestLoadKeyRing(t *testing.T) {
+	dir := t.TempDir()
+	for _, id := range []string{"2025-01", "2025-02"} {
+		key := newTestKey(t, id)
+		der, err := x509.MarshalPKCS8PrivateKey(key.private)
+		if err != nil {
+			t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(filepath.Join(dir, id+".pem"), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := LoadKeyRing(dir, "2025-02")
+	if err != nil {
+		t.Fatalf("LoadKeyRing() error = %v", err)
+	}
+	if keys.signing.ID != "2025-02" {
+		t.Errorf("signing key = %s, want 2025-02", keys.signing.ID)
+	}
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", len(jwks.Keys))
+	}
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.Alg != "EdDSA" || jwk.X == "" {
+			t.Errorf("unexpected JWK %+v", jwk)
+		}
+	}
+
+	if _, err := LoadKeyRing(dir, "missing"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("LoadKeyRing() with unknown signing key error = %v", err)
+	}
+}
+
+func TestMakeClientJWT(t *testing.T) {
+	keys := newTestKeyRing(t, "key-1")
+	userID := uuid.New()
+	clientID := uuid.New()
+	token, err := MakeClientJWT(userID, 3, clientID, []Scope{ScopeChirpsRead}, keys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeClientJWT() error = %v", err)
+	}
+
+	if got, err := ValidateJWT(token, keys, nil); err != nil || got != userID {
+		t.Errorf("ValidateJWT() = %v, %v, want %v", got, err, userID)
+	}
+	claims, err := ParseJWT(token, keys, nil)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if !claims.IsDelegated() || claims.ClientID != clientID.String() {
+		t.Errorf("ClientID = %q, want %q", claims.ClientID, clientID)
+	}
+	if scopes := claims.Scopes(); len(scopes) != 1 || scopes[0] != ScopeChirpsRead {
+		t.Errorf("Scopes() = %v, want [chirps:read]", scopes)
+	}
+
+	first, _ := MakeJWT(userID, 3, keys, time.Hour)
+	claims, _ = ParseJWT(first, keys, nil)
+	if claims.IsDelegated() {
+		t.Error("first-party token reported as delegated")
+	}
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Argon2Params tunes Argon2id. They are stored in every hash, so changing
+// them only affects new hashes; NeedsRehash spots the old ones.
+type Argon2Params struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params is the second recommended option from RFC 9106, for
+// machines that can't spare 2 GiB per hash.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var argon2Params = DefaultArgon2Params
+
+// SetArgon2Params changes the parameters HashPassword uses.
+func SetArgon2Params(p Argon2Params) error {
+	if p.Memory < 8*uint32(p.Parallelism) || p.Iterations < 1 || p.Parallelism < 1 {
+		return fmt.Errorf("invalid Argon2 parameters m=%d,t=%d,p=%d", p.Memory, p.Iterations, p.Parallelism)
+	}
+	if p.SaltLength < 8 || p.KeyLength < 16 {
+		return errors.New("Argon2 salt and key must be at least 8 and 16 bytes")
+	}
+	argon2Params = p
+	return nil
+}
+
+const argon2idPrefix = "$argon2id$"
+
+var b64 = base64.RawStdEncoding
+
+// HashPassword hashes password with Argon2id, encoded in the PHC string
+// format: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>.
+func HashPassword(password string) (string, error) {
+	p := argon2Params
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// CheckPasswordHash verifies password against an Argon2id hash, or a bcrypt
+// hash from before Argon2id was introduced.
+func CheckPasswordHash(hash, password string) error {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	}
+	p, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return errors.New("password does not match hash")
+	}
+	return nil
+}
+
+// NeedsRehash reports whether hash should be replaced by a fresh
+// HashPassword, because it uses bcrypt or outdated Argon2 parameters.
+func NeedsRehash(hash string) bool {
+	p, _, _, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+	return p != argon2Params
+}
+
+func decodeArgon2Hash(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, errors.New("not an Argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported Argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid Argon2 parameters: %w", err)
+	}
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("invalid Argon2 salt: %w", err)
+	}
+	key, err := b64.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("invalid Argon2 hash: %w", err)
+	}
+	if len(key) == 0 {
+		return p, nil, nil, errors.New("empty Argon2 hash")
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPasswordFormat(t *testing.T) {
+	hash, err := HashPassword("correctPassword123!")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=4$") {
+		t.Errorf("HashPassword() = %q, want a PHC Argon2id string with the default parameters", hash)
+	}
+	other, _ := HashPassword("correctPassword123!")
+	if hash == other {
+		t.Error("HashPassword() returned the same hash twice, salt isn't random")
+	}
+	if NeedsRehash(hash) {
+		t.Error("NeedsRehash() = true for a hash with the current parameters")
+	}
+}
+
+func TestCheckLegacyBcryptHash(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correctPassword123!"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPasswordHash(string(legacy), "correctPassword123!"); err != nil {
+		t.Errorf("CheckPasswordHash() error = %v for a matching bcrypt hash", err)
+	}
+	if err := CheckPasswordHash(string(legacy), "wrongPassword"); err == nil {
+		t.Error("CheckPasswordHash() accepted the wrong password for a bcrypt hash")
+	}
+	if !NeedsRehash(string(legacy)) {
+		t.Error("NeedsRehash() = false for a bcrypt hash")
+	}
+}
+
+func TestSetArgon2Params(t *testing.T) {
+	t.Cleanup(func() { argon2Params = DefaultArgon2Params })
+
+	old, _ := HashPassword("correctPassword123!")
+	err := SetArgon2Params(Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	if err != nil {
+		t.Fatalf("SetArgon2Params() error = %v", err)
+	}
+	if !NeedsRehash(old) {
+		t.Error("NeedsRehash() = false after the parameters changed")
+	}
+	// Hashes made with other parameters still verify.
+	if err := CheckPasswordHash(old, "correctPassword123!"); err != nil {
+		t.Errorf("CheckPasswordHash() error = %v for a hash with old parameters", err)
+	}
+	hash, _ := HashPassword("correctPassword123!")
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("HashPassword() = %q, want the new parameters", hash)
+	}
+
+	if err := SetArgon2Params(Argon2Params{Memory: 1024, Iterations: 0, Parallelism: 1, SaltLength: 16, KeyLength: 32}); err == nil {
+		t.Error("SetArgon2Params() accepted zero iterations")
+	}
+}
+
+func TestCheckMalformedArgon2Hash(t *testing.T) {
+	hash, _ := HashPassword("correctPassword123!")
+	parts := strings.Split(hash, "$")
+	tests := []string{
+		"$argon2id$v=19$m=65536,t=3,p=4$salt",
+		strings.Replace(hash, "v=19", "v=16", 1),
+		strings.Replace(hash, "m=65536", "m=abc", 1),
+		strings.Join(append(parts[:5:5], "!!!"), "$"),
+		strings.Join(append(parts[:5:5], ""), "$"),
+	}
+	for _, h := range tests {
+		if err := CheckPasswordHash(h, "correctPassword123!"); err == nil {
+			t.Errorf("CheckPasswordHash(%q) should have failed", h)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scope limits what a delegated credential may do on behalf of a user.
+type Scope string
+
+const (
+	ScopeChirpsRead   Scope = "chirps:read"
+	ScopeChirpsWrite  Scope = "chirps:write"
+	ScopeProfileWrite Scope = "profile:write"
+)
+
+// AllScopes lists every scope a credential can be granted.
+var AllScopes = []Scope{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// ParseScopes splits a space-separated scope string, rejecting unknown
+// scopes and dropping duplicates.
+func ParseScopes(s string) ([]Scope, error) {
+	scopes := []Scope{}
+	for _, field := range strings.Fields(s) {
+		scope := Scope(field)
+		if !slices.Contains(AllScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", field)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// FormatScopes joins scopes into the space-separated form ParseScopes reads.
+func FormatScopes(scopes []Scope) string {
+	fields := make([]string, len(scopes))
+	for i, scope := range scopes {
+		fields[i] = string(scope)
+	}
+	return strings.Join(fields, " ")
+}
+
+// MakeAPIKey returns a new personal access token. The prefix makes leaked
+// tokens easy to spot in logs and for secret scanners.
+func MakeAPIKey() (string, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return "chirpy_pat_" + token, nil
+}
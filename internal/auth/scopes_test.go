@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Scope
+		wantErr bool
+	}{
+		{
+			name:  "Empty",
+			input: "",
+			want:  []Scope{},
+		},
+		{
+			name:  "Multiple scopes",
+			input: "chirps:read  chirps:write",
+			want:  []Scope{ScopeChirpsRead, ScopeChirpsWrite},
+		},
+		{
+			name:  "Duplicates dropped",
+			input: "profile:write profile:write",
+			want:  []Scope{ScopeProfileWrite},
+		},
+		{
+			name:    "Unknown scope",
+			input:   "chirps:read admin",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScopes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatScopesRoundTrip(t *testing.T) {
+	formatted := FormatScopes(AllScopes)
+	parsed, err := ParseScopes(formatted)
+	if err != nil {
+		t.Fatalf("ParseScopes() error = %v", err)
+	}
+	if !reflect.DeepEqual(parsed, AllScopes) {
+		t.Errorf("round trip = %v, want %v", parsed, AllScopes)
+	}
+}
+
+func TestMakeAPIKey(t *testing.T) {
+	key, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("MakeAPIKey() error = %v", err)
+	}
+	if !strings.HasPrefix(key, "chirpy_pat_") {
+		t.Errorf("MakeAPIKey() = %q, missing prefix", key)
+	}
+	other, _ := MakeAPIKey()
+	if key == other {
+		t.Error("MakeAPIKey() returned the same key twice")
+	}
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults every authenticator
+// app understands, so they are not configurable.
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// totpSkew is how many periods either side of now are accepted, to
+	// allow for clock drift and slow typing.
+	totpSkew = 1
+)
+
+// TokenTypeTwoFactor is the issuer of challenge tokens handed out between
+// the password and TOTP steps of a login.
+const TokenTypeTwoFactor TokenType = "chirpy-2fa-challenge"
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new base32-encoded 160-bit secret.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(secret), nil
+}
+
+// TOTPURI returns the otpauth:// URI authenticator apps scan as a QR code.
+func TOTPURI(secret, account, issuer string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// TOTPStep returns the time step t falls into.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// ValidateTOTP checks code against secret at time t and returns the step it
+// matched. Callers must reject steps at or before the last one accepted for
+// the user, otherwise a code could be replayed within its window.
+func ValidateTOTP(secret, code string, t time.Time) (int64, error) {
+	key, err := b32.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	code = strings.TrimSpace(code)
+	now := TOTPStep(t)
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+	return 0, errors.New("invalid TOTP code")
+}
+
+// GenerateRecoveryCodes returns n single-use codes of the form xxxxx-xxxxx.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(b32.EncodeToString(raw))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode makes user input comparable with generated codes,
+// so codes can be hashed before they are looked up.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.Join(strings.Fields(code), ""))
+	code = strings.ReplaceAll(code, "-", "")
+	if len(code) != 10 {
+		return code
+	}
+	return code[:5] + "-" + code[5:]
+}
+
+// Challenge is a validated login challenge. Its ID lets the caller make
+// sure each challenge is only used once.
+type Challenge struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+// MakeChallengeJWT issues the short-lived token proving a user passed the
+// password step of a login. It is not accepted as an access token.
+func MakeChallengeJWT(userID uuid.UUID, keys *KeyRing, expiresIn time.Duration) (string, error) {
+	return keys.sign(jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		Issuer:    string(TokenTypeTwoFactor),
+		Subject:   userID.String(),
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+	})
+}
+
+// ValidateChallengeJWT returns the challenge a token carries.
+func ValidateChallengeJWT(tokenString string, keys *KeyRing) (Challenge, error) {
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&claims,
+		keys.keyFunc,
+		jwt.WithValidMethods(validMethods),
+		jwt.WithIssuer(string(TokenTypeTwoFactor)),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return Challenge{}, err
+	}
+	id, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return Challenge{}, fmt.Errorf("invalid challenge ID: %w", err)
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return Challenge{}, fmt.Errorf("invalid user ID: %w", err)
+	}
+	return Challenge{ID: id, UserID: userID, ExpiresAt: claims.ExpiresAt.Time}, nil
+}
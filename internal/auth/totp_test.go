@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// rfc6238Secret is the SHA-1 key from the RFC 6238 test vectors.
+var rfc6238Secret = b32.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// The RFC lists 8-digit codes; ours are the last 6 digits of each.
+	tests := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range tests {
+		step, err := ValidateTOTP(rfc6238Secret, want, time.Unix(unix, 0))
+		if err != nil {
+			t.Errorf("ValidateTOTP() at %d error = %v", unix, err)
+			continue
+		}
+		if step != unix/totpPeriod {
+			t.Errorf("ValidateTOTP() at %d step = %d, want %d", unix, step, unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+	key, _ := b32.DecodeString(secret)
+	now := time.Unix(1700000000, 0)
+	step := TOTPStep(now)
+
+	tests := []struct {
+		name    string
+		code    string
+		wantErr bool
+	}{
+		{"Current step", totpCode(key, step), false},
+		{"Previous step", totpCode(key, step-1), false},
+		{"Next step", totpCode(key, step+1), false},
+		{"Too old", totpCode(key, step-2), true},
+		{"Garbage", "abcdef", true},
+		{"Empty", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateTOTP(secret, tt.code, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTOTP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "alice@example.com", "Chirpy")
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("url.Parse() error = %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("URI = %s, want otpauth://totp/...", uri)
+	}
+	if u.Path != "/Chirpy:alice@example.com" {
+		t.Errorf("label = %s", u.Path)
+	}
+	if u.Query().Get("secret") != "JBSWY3DPEHPK3PXP" || u.Query().Get("issuer") != "Chirpy" {
+		t.Errorf("query = %v", u.Query())
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q has the wrong shape", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+		if got := NormalizeRecoveryCode(" " + strings.ToUpper(strings.ReplaceAll(code, "-", "")) + " "); got != code {
+			t.Errorf("NormalizeRecoveryCode() = %q, want %q", got, code)
+		}
+	}
+}
+
+func TestChallengeJWT(t *testing.T) {
+	keys := newTestKeyRing(t, "key-1")
+	userID := uuid.New()
+
+	challenge, err := MakeChallengeJWT(userID, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeChallengeJWT() error = %v", err)
+	}
+	got, err := ValidateChallengeJWT(challenge, keys)
+	if err != nil || got.UserID != userID || got.ID == uuid.Nil || got.ExpiresAt.IsZero() {
+		t.Errorf("ValidateChallengeJWT() = %+v, %v, want a challenge for %v", got, err, userID)
+	}
+	again, _ := MakeChallengeJWT(userID, keys, time.Minute)
+	if other, _ := ValidateChallengeJWT(again, keys); other.ID == got.ID {
+		t.Error("two challenges share an ID")
+	}
+	if _, err := ValidateJWT(challenge, keys, nil); err == nil {
+		t.Error("challenge token was accepted as an access token")
+	}
+
+	access, _ := MakeJWT(userID, 0, keys, time.Hour)
+	if _, err := ValidateChallengeJWT(access, keys); err == nil {
+		t.Error("access token was accepted as a challenge token")
+	}
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webhookSignaturePrefix marks the scheme of each signature in a webhook's
+// signature header.
+const webhookSignaturePrefix = "sha256="
+
+var (
+	ErrWebhookSignature = errors.New("webhook signature doesn't match")
+	ErrWebhookTimestamp = errors.New("webhook timestamp outside tolerance")
+)
+
+// WebhookVerifier checks HMAC-SHA256 signatures on webhook deliveries.
+// Any of Secrets may have signed a delivery, so a new secret can be added
+// before the sender switches to it and the old one removed afterwards.
+type WebhookVerifier struct {
+	Secrets [][]byte
+	// Tolerance is how far a delivery's timestamp may be from now. Older
+	// deliveries are refused so a captured request can't be replayed
+	// later.
+	Tolerance time.Duration
+}
+
+// SignWebhook signs a delivery the way WebhookVerifier expects: an
+// HMAC-SHA256 of the timestamp, a dot and the raw body.
+func SignWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery received at now. timestamp is in Unix seconds
+// and signatures is a comma-separated list of "sha256=<hex>" values, of
+// which one must match.
+func (v WebhookVerifier) Verify(timestamp, signatures string, body []byte, now time.Time) error {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrWebhookTimestamp
+	}
+	age := now.Sub(time.Unix(sec, 0))
+	if age > v.Tolerance || age < -v.Tolerance {
+		return ErrWebhookTimestamp
+	}
+
+	for _, secret := range v.Secrets {
+		want := []byte(SignWebhook(secret, timestamp, body))
+		for sig := range strings.SplitSeq(signatures, ",") {
+			if hmac.Equal([]byte(strings.TrimSpace(sig)), want) {
+				return nil
+			}
+		}
+	}
+	return ErrWebhookSignature
+}
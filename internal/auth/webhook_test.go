@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWebhookVerifier(t *testing.T) {
+	oldSecret := []byte("old-secret")
+	newSecret := []byte("new-secret")
+	v := WebhookVerifier{Secrets: [][]byte{newSecret, oldSecret}, Tolerance: 5 * time.Minute}
+	now := time.Unix(1_700_000_000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{"event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+	stale := strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name       string
+		timestamp  string
+		signatures string
+		body       []byte
+		wantErr    error
+	}{
+		{
+			name:       "Current secret",
+			timestamp:  ts,
+			signatures: SignWebhook(newSecret, ts, body),
+			body:       body,
+		},
+		{
+			name:       "Previous secret",
+			timestamp:  ts,
+			signatures: SignWebhook(oldSecret, ts, body),
+			body:       body,
+		},
+		{
+			name:       "One of several signatures",
+			timestamp:  ts,
+			signatures: SignWebhook([]byte("retired"), ts, body) + ", " + SignWebhook(newSecret, ts, body),
+			body:       body,
+		},
+		{
+			name:       "Unknown secret",
+			timestamp:  ts,
+			signatures: SignWebhook([]byte("retired"), ts, body),
+			body:       body,
+			wantErr:    ErrWebhookSignature,
+		},
+		{
+			name:       "Tampered body",
+			timestamp:  ts,
+			signatures: SignWebhook(newSecret, ts, body),
+			body:       []byte(`{"event":"user.upgraded","data":{"user_id":"00000000-0000-0000-0000-000000000000"}}`),
+			wantErr:    ErrWebhookSignature,
+		},
+		{
+			name:       "Signature moved to another timestamp",
+			timestamp:  strconv.FormatInt(now.Unix()-1, 10),
+			signatures: SignWebhook(newSecret, ts, body),
+			body:       body,
+			wantErr:    ErrWebhookSignature,
+		},
+		{
+			name:       "Stale delivery",
+			timestamp:  stale,
+			signatures: SignWebhook(newSecret, stale, body),
+			body:       body,
+			wantErr:    ErrWebhookTimestamp,
+		},
+		{
+			name:       "Bad timestamp",
+			timestamp:  "yesterday",
+			signatures: SignWebhook(newSecret, "yesterday", body),
+			body:       body,
+			wantErr:    ErrWebhookTimestamp,
+		},
+		{
+			name:      "Missing signature",
+			timestamp: ts,
+			body:      body,
+			wantErr:   ErrWebhookSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Verify(tt.timestamp, tt.signatures, tt.body, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
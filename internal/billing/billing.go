@@ -0,0 +1,62 @@
+// Package billing turns webhook deliveries from payment providers into
+// provider-neutral subscription events, so the rest of Chirpy doesn't care
+// who took the money.
+package billing
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType is what happened to a subscription.
+type EventType string
+
+const (
+	// EventActivated starts or restarts a subscription.
+	EventActivated EventType = "activated"
+	// EventRenewed extends an active subscription to a new period end.
+	EventRenewed EventType = "renewed"
+	// EventPaymentFailed means a charge for the subscription failed. The
+	// provider will usually retry before canceling.
+	EventPaymentFailed EventType = "payment_failed"
+	// EventCanceled ends a subscription straight away.
+	EventCanceled EventType = "canceled"
+)
+
+// ErrMissingEventID is returned by Parse for deliveries that should carry
+// an event ID but don't, since they couldn't be told apart from each other.
+var ErrMissingEventID = errors.New("event has no ID")
+
+// Event is a normalized webhook delivery.
+type Event struct {
+	// ID is the provider's ID for the event, which stays the same when a
+	// delivery is retried.
+	ID string
+	// ProviderType is the provider's own name for the event.
+	ProviderType string
+	// Type is empty for events that don't affect subscriptions.
+	Type EventType
+	// UserID is uuid.Nil if the event doesn't say which user it is for.
+	UserID uuid.UUID
+	Plan   string
+	// CurrentPeriodEnd is zero if the provider didn't say.
+	CurrentPeriodEnd time.Time
+	// SubscriptionRef is the provider's ID for the subscription, if any.
+	SubscriptionRef string
+}
+
+// Provider authenticates and normalizes one payment provider's webhooks.
+type Provider interface {
+	// Name identifies the provider in stored events and subscriptions.
+	Name() string
+	// Verify checks that a delivery received at now really came from the
+	// provider.
+	Verify(header http.Header, body []byte, now time.Time) error
+	// Parse reads a delivery. It is kept separate from Verify so stored
+	// deliveries can be parsed again later, with a nil header; only the
+	// event ID may depend on the header.
+	Parse(header http.Header, body []byte) (Event, error)
+}
@@ -0,0 +1,83 @@
+package billing
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// Polka's event names.
+const (
+	polkaUpgraded      = "user.upgraded"
+	polkaRenewed       = "user.renewed"
+	polkaPaymentFailed = "user.payment_failed"
+	polkaDowngraded    = "user.downgraded"
+)
+
+// Polka handles webhooks from Polka, which only sells one plan. Deliveries
+// are signed with X-Polka-Timestamp and X-Polka-Signature (see
+// auth.WebhookVerifier).
+type Polka struct {
+	Verifier auth.WebhookVerifier
+	// Plan is the Chirpy plan Polka subscriptions grant.
+	Plan string
+}
+
+// polkaPayload is a Polka delivery. Only user_id is always present;
+// current_period_end and subscription_id come with subscription events
+// when Polka knows them.
+type polkaPayload struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  struct {
+		UserID           uuid.UUID  `json:"user_id"`
+		CurrentPeriodEnd *time.Time `json:"current_period_end"`
+		SubscriptionID   string     `json:"subscription_id"`
+	} `json:"data"`
+}
+
+func (p *Polka) Name() string {
+	return "polka"
+}
+
+func (p *Polka) Verify(header http.Header, body []byte, now time.Time) error {
+	return p.Verifier.Verify(header.Get("X-Polka-Timestamp"), header.Get("X-Polka-Signature"), body, now)
+}
+
+func (p *Polka) Parse(header http.Header, body []byte) (Event, error) {
+	payload := polkaPayload{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return Event{}, err
+	}
+	event := Event{
+		ID:              payload.ID,
+		ProviderType:    payload.Event,
+		UserID:          payload.Data.UserID,
+		Plan:            p.Plan,
+		SubscriptionRef: payload.Data.SubscriptionID,
+	}
+	if event.ID == "" {
+		// Older deliveries have no ID. A retry resends the same body and
+		// timestamp, while the same event sent again later, say a second
+		// upgrade after a downgrade, gets a new timestamp.
+		event.ID = auth.HashToken(header.Get("X-Polka-Timestamp") + "." + string(body))
+	}
+	if payload.Data.CurrentPeriodEnd != nil {
+		event.CurrentPeriodEnd = payload.Data.CurrentPeriodEnd.UTC()
+	}
+
+	switch payload.Event {
+	case polkaUpgraded:
+		event.Type = EventActivated
+	case polkaRenewed:
+		event.Type = EventRenewed
+	case polkaPaymentFailed:
+		event.Type = EventPaymentFailed
+	case polkaDowngraded:
+		event.Type = EventCanceled
+	}
+	return event, nil
+}
@@ -0,0 +1,98 @@
+package billing
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestPolkaParse(t *testing.T) {
+	p := &Polka{Plan: "chirpy_red"}
+	userID := uuid.MustParse("3311741c-680c-4546-99f3-fc9efac2036c")
+
+	tests := []struct {
+		name     string
+		body     string
+		wantType EventType
+	}{
+		{"Upgraded", `{"event": "user.upgraded", "data": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c"}}`, EventActivated},
+		{"Renewed", `{"event": "user.renewed", "data": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c"}}`, EventRenewed},
+		{"Payment failed", `{"event": "user.payment_failed", "data": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c"}}`, EventPaymentFailed},
+		{"Downgraded", `{"event": "user.downgraded", "data": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c"}}`, EventCanceled},
+		{"Other event", `{"event": "user.renamed", "data": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c"}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := p.Parse(nil, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if event.Type != tt.wantType {
+				t.Errorf("Parse() Type = %q, want %q", event.Type, tt.wantType)
+			}
+			if event.UserID != userID || event.Plan != "chirpy_red" {
+				t.Errorf("Parse() = %+v, want user %s on chirpy_red", event, userID)
+			}
+		})
+	}
+}
+
+func TestPolkaParseDetails(t *testing.T) {
+	p := &Polka{Plan: "chirpy_red"}
+	body := []byte(`{"id": "evt_1", "event": "user.renewed", "data": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c", "current_period_end": "2026-11-19T12:00:00+02:00", "subscription_id": "sub_1"}}`)
+	event, err := p.Parse(nil, body)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if event.ID != "evt_1" || event.ProviderType != "user.renewed" || event.SubscriptionRef != "sub_1" {
+		t.Errorf("Parse() = %+v", event)
+	}
+	if want := time.Date(2026, 11, 19, 10, 0, 0, 0, time.UTC); !event.CurrentPeriodEnd.Equal(want) {
+		t.Errorf("Parse() CurrentPeriodEnd = %v, want %v", event.CurrentPeriodEnd, want)
+	}
+
+	// Without an ID, a retry is the same event but a later delivery of the
+	// same body isn't.
+	body = []byte(`{"event": "user.upgraded", "data": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+	header := http.Header{}
+	header.Set("X-Polka-Timestamp", "1795000000")
+	first, _ := p.Parse(header, body)
+	retry, _ := p.Parse(header.Clone(), body)
+	if first.ID == "" || first.ID != retry.ID {
+		t.Errorf("Parse() IDs = %q and %q, want the same non-empty ID", first.ID, retry.ID)
+	}
+	header.Set("X-Polka-Timestamp", "1797600000")
+	later, _ := p.Parse(header, body)
+	if later.ID == first.ID {
+		t.Errorf("Parse() ID of a later delivery = %q, want a new one", later.ID)
+	}
+
+	if _, err := p.Parse(nil, []byte(`{"event":`)); err == nil {
+		t.Error("Parse() of invalid JSON error = nil")
+	}
+}
+
+func TestPolkaVerify(t *testing.T) {
+	secret := []byte("polka-secret")
+	p := &Polka{Verifier: auth.WebhookVerifier{Secrets: [][]byte{secret}, Tolerance: time.Minute}}
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{"event": "user.upgraded"}`)
+
+	header := http.Header{}
+	header.Set("X-Polka-Timestamp", ts)
+	header.Set("X-Polka-Signature", auth.SignWebhook(secret, ts, body))
+	if err := p.Verify(header, body, now); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	header.Set("X-Polka-Signature", auth.SignWebhook([]byte("other"), ts, body))
+	if err := p.Verify(header, body, now); !errors.Is(err, auth.ErrWebhookSignature) {
+		t.Errorf("Verify() with wrong secret error = %v, want %v", err, auth.ErrWebhookSignature)
+	}
+}
@@ -0,0 +1,109 @@
+package billing
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// Stripe handles webhooks in Stripe's format, from Stripe or any provider
+// that copies it. Only customer.subscription.* events are acted on; the
+// subscription's metadata must carry the Chirpy "user_id", and may name
+// the "plan".
+type Stripe struct {
+	Verifier auth.WebhookVerifier
+	// DefaultPlan is used for subscriptions whose metadata has no plan.
+	DefaultPlan string
+}
+
+type stripePayload struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+type stripeSubscription struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	// CurrentPeriodEnd is in Unix seconds.
+	CurrentPeriodEnd int64             `json:"current_period_end"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+func (s *Stripe) Name() string {
+	return "stripe"
+}
+
+// Verify checks a Stripe-Signature header of the form
+// "t=<unix seconds>,v1=<hex>[,v1=<hex>...]". The v1 signatures are the
+// same HMAC-SHA256 of timestamp, dot and body that auth.WebhookVerifier
+// checks.
+func (s *Stripe) Verify(header http.Header, body []byte, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for part := range strings.SplitSeq(header.Get("Stripe-Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, "sha256="+value)
+		}
+	}
+	return s.Verifier.Verify(timestamp, strings.Join(signatures, ","), body, now)
+}
+
+func (s *Stripe) Parse(header http.Header, body []byte) (Event, error) {
+	payload := stripePayload{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return Event{}, err
+	}
+	if payload.ID == "" {
+		return Event{}, ErrMissingEventID
+	}
+	event := Event{ID: payload.ID, ProviderType: payload.Type}
+	if !strings.HasPrefix(payload.Type, "customer.subscription.") {
+		return event, nil
+	}
+
+	sub := stripeSubscription{}
+	if err := json.Unmarshal(payload.Data.Object, &sub); err != nil {
+		return Event{}, err
+	}
+	event.SubscriptionRef = sub.ID
+	if userID, err := uuid.Parse(sub.Metadata["user_id"]); err == nil {
+		event.UserID = userID
+	}
+	event.Plan = sub.Metadata["plan"]
+	if event.Plan == "" {
+		event.Plan = s.DefaultPlan
+	}
+	if sub.CurrentPeriodEnd > 0 {
+		event.CurrentPeriodEnd = time.Unix(sub.CurrentPeriodEnd, 0).UTC()
+	}
+
+	switch payload.Type {
+	case "customer.subscription.created":
+		if sub.Status == "active" || sub.Status == "trialing" {
+			event.Type = EventActivated
+		}
+	case "customer.subscription.updated":
+		switch sub.Status {
+		case "active", "trialing":
+			event.Type = EventRenewed
+		case "past_due", "unpaid":
+			event.Type = EventPaymentFailed
+		case "canceled", "incomplete_expired":
+			event.Type = EventCanceled
+		}
+	case "customer.subscription.deleted":
+		event.Type = EventCanceled
+	}
+	return event, nil
+}
@@ -0,0 +1,126 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+func stripeBody(eventType, status, metadata string) []byte {
+	return fmt.Appendf(nil, `{
+		"id": "evt_1",
+		"type": %q,
+		"data": {"object": {
+			"id": "sub_1",
+			"status": %q,
+			"current_period_end": 1795000000,
+			"metadata": %s
+		}}
+	}`, eventType, status, metadata)
+}
+
+func TestStripeParse(t *testing.T) {
+	s := &Stripe{DefaultPlan: "chirpy_red"}
+	userID := uuid.MustParse("3311741c-680c-4546-99f3-fc9efac2036c")
+	metadata := `{"user_id": "3311741c-680c-4546-99f3-fc9efac2036c"}`
+
+	tests := []struct {
+		name      string
+		eventType string
+		status    string
+		wantType  EventType
+	}{
+		{"Created active", "customer.subscription.created", "active", EventActivated},
+		{"Created incomplete", "customer.subscription.created", "incomplete", ""},
+		{"Renewed", "customer.subscription.updated", "active", EventRenewed},
+		{"Trial", "customer.subscription.updated", "trialing", EventRenewed},
+		{"Past due", "customer.subscription.updated", "past_due", EventPaymentFailed},
+		{"Unpaid", "customer.subscription.updated", "unpaid", EventPaymentFailed},
+		{"Canceled", "customer.subscription.updated", "canceled", EventCanceled},
+		{"Deleted", "customer.subscription.deleted", "canceled", EventCanceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := s.Parse(nil, stripeBody(tt.eventType, tt.status, metadata))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if event.Type != tt.wantType {
+				t.Errorf("Parse() Type = %q, want %q", event.Type, tt.wantType)
+			}
+			if event.ID != "evt_1" || event.UserID != userID || event.SubscriptionRef != "sub_1" || event.Plan != "chirpy_red" {
+				t.Errorf("Parse() = %+v", event)
+			}
+			if !event.CurrentPeriodEnd.Equal(time.Unix(1795000000, 0)) {
+				t.Errorf("Parse() CurrentPeriodEnd = %v", event.CurrentPeriodEnd)
+			}
+		})
+	}
+}
+
+func TestStripeParseOther(t *testing.T) {
+	s := &Stripe{DefaultPlan: "chirpy_red"}
+
+	event, err := s.Parse(nil, stripeBody("customer.subscription.created", "active", `{"user_id": "3311741c-680c-4546-99f3-fc9efac2036c", "plan": "chirpy_blue"}`))
+	if err != nil || event.Plan != "chirpy_blue" {
+		t.Errorf("Parse() with plan metadata = %+v, %v, want plan chirpy_blue", event, err)
+	}
+
+	event, err = s.Parse(nil, stripeBody("customer.subscription.created", "active", `{}`))
+	if err != nil || event.UserID != uuid.Nil {
+		t.Errorf("Parse() without user_id = %+v, %v, want uuid.Nil", event, err)
+	}
+
+	event, err = s.Parse(nil, []byte(`{"id": "evt_2", "type": "charge.refunded", "data": {"object": {"amount": 500}}}`))
+	if err != nil || event.Type != "" || event.ID != "evt_2" || event.ProviderType != "charge.refunded" {
+		t.Errorf("Parse() of other event = %+v, %v", event, err)
+	}
+
+	_, err = s.Parse(nil, []byte(`{"type": "customer.subscription.deleted", "data": {"object": {"id": "sub_1"}}}`))
+	if !errors.Is(err, ErrMissingEventID) {
+		t.Errorf("Parse() without id error = %v, want %v", err, ErrMissingEventID)
+	}
+}
+
+func TestStripeVerify(t *testing.T) {
+	oldSecret := []byte("whsec_old")
+	newSecret := []byte("whsec_new")
+	s := &Stripe{Verifier: auth.WebhookVerifier{Secrets: [][]byte{newSecret, oldSecret}, Tolerance: 5 * time.Minute}}
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := stripeBody("customer.subscription.deleted", "canceled", `{}`)
+	v1 := func(secret []byte) string {
+		return "v1=" + strings.TrimPrefix(auth.SignWebhook(secret, ts, body), "sha256=")
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		wantErr   error
+	}{
+		{"Signed", "t=" + ts + "," + v1(newSecret), nil},
+		{"Old secret among several", "t=" + ts + "," + v1([]byte("whsec_retired")) + "," + v1(oldSecret), nil},
+		{"Unknown scheme ignored", "t=" + ts + ",v0=abc," + v1(newSecret), nil},
+		{"Wrong secret", "t=" + ts + "," + v1([]byte("whsec_retired")), auth.ErrWebhookSignature},
+		{"No timestamp", v1(newSecret), auth.ErrWebhookTimestamp},
+		{"Missing header", "", auth.ErrWebhookTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.signature != "" {
+				header.Set("Stripe-Signature", tt.signature)
+			}
+			if err := s.Verify(header, body, now); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
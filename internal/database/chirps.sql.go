@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -62,7 +63,10 @@ func (q *Queries) DeleteChirpByIDAndUserID(ctx context.Context, arg DeleteChirpB
 }
 
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at ASC
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id FROM chirps
+LEFT JOIN users ON users.id = chirps.user_id
+WHERE users.deactivated_at IS NULL
+ORDER BY chirps.created_at ASC
 `
 
 func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
@@ -95,7 +99,9 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id FROM chirps
+LEFT JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1 AND users.deactivated_at IS NULL
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -110,3 +116,80 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 	)
 	return i, err
 }
+
+const getChirpsByUser = `-- name: GetChirpsByUser :many
+SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE user_id = $1 ORDER BY created_at ASC
+`
+
+func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.NullUUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const importChirp = `-- name: ImportChirp :exec
+INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+VALUES (
+    gen_random_uuid(), $1, $1, $2, $3
+)
+`
+
+type ImportChirpParams struct {
+	CreatedAt time.Time
+	Body      string
+	UserID    uuid.NullUUID
+}
+
+func (q *Queries) ImportChirp(ctx context.Context, arg ImportChirpParams) error {
+	_, err := q.db.ExecContext(ctx, importChirp, arg.CreatedAt, arg.Body, arg.UserID)
+	return err
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+UPDATE chirps SET body = $3,
+updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING id, created_at, updated_at, body, user_id
+`
+
+type UpdateChirpParams struct {
+	ID     uuid.UUID
+	UserID uuid.NullUUID
+	Body   string
+}
+
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.ID, arg.UserID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+	)
+	return i, err
+}
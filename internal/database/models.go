@@ -11,6 +11,19 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
@@ -19,20 +32,131 @@ type Chirp struct {
 	UserID    uuid.NullUUID
 }
 
-type RefreshToken struct {
-	Token     string
+type DataExport struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	Status      string
+	CompletedAt sql.NullTime
+	ExpiresAt   sql.NullTime
+	Archive     []byte
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scope         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   string
+	RedirectUris string
+}
+
+type OauthRefreshToken struct {
+	TokenHash string
 	CreatedAt time.Time
-	UpdatedAt time.Time
+	ClientID  uuid.UUID
 	UserID    uuid.UUID
+	Scope     string
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
 }
 
+type PasswordReset struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	UserID         uuid.UUID
+	ExpiresAt      time.Time
+	RevokedAt      sql.NullTime
+	FamilyID       uuid.UUID
+	ReplacedByHash sql.NullString
+	UserAgent      string
+	Ip             string
+	LastUsedAt     time.Time
+}
+
+type SpentLoginChallenge struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+type Subscription struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	UserID           uuid.UUID
+	Plan             string
+	Status           string
+	CurrentPeriodEnd sql.NullTime
+	Provider         string
+	ProviderRef      sql.NullString
+}
+
 type User struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	Password            string
+	FailedLoginAttempts int32
+	LockedUntil         sql.NullTime
+	TokenVersion        int32
+	BannedAt            sql.NullTime
+	TotpSecret          sql.NullString
+	TotpEnabledAt       sql.NullTime
+	TotpLastStep        int64
+	EmailVerifiedAt     sql.NullTime
+	PendingEmail        sql.NullString
+	Handle              string
+	DisplayName         string
+	Bio                 string
+	AvatarMediaID       uuid.NullUUID
+	Location            string
+	Website             string
+	DeactivatedAt       sql.NullTime
+}
+
+type WebhookEvent struct {
 	ID          uuid.UUID
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
-	Email       string
-	Password    string
-	IsChirpyRed sql.NullBool
+	Provider    string
+	EventID     string
+	EventType   string
+	Payload     []byte
+	Status      string
+	Error       sql.NullString
+	Attempts    int32
+	ProcessedAt sql.NullTime
 }
@@ -7,55 +7,197 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (
-    token, created_at, updated_at, user_id, expires_at, revoked_at
+    token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id,
+    user_agent, ip, last_used_at
 ) VALUES (
-    $1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', NULL
+    $1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', NULL, $3,
+    $4, $5, NOW()
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by_hash, user_agent, ip, last_used_at
 `
 
 type CreateRefreshTokenParams struct {
-	Token  string
-	UserID uuid.UUID
+	TokenHash string
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	UserAgent string
+	Ip        string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.Ip,
+	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedByHash,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
 
-const revokeRefreshToken = `-- name: RevokeRefreshToken :one
+const getActiveSessionsForUser = `-- name: GetActiveSessionsForUser :many
+SELECT rt.family_id, rt.user_agent, rt.ip, rt.last_used_at, rt.expires_at,
+    (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = rt.family_id)::timestamp AS started_at
+FROM refresh_tokens rt
+WHERE rt.user_id = $1
+  AND (rt.revoked_at IS NULL)
+  AND (rt.expires_at > NOW())
+ORDER BY rt.last_used_at DESC
+`
+
+type GetActiveSessionsForUserRow struct {
+	FamilyID   uuid.UUID
+	UserAgent  string
+	Ip         string
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	StartedAt  time.Time
+}
+
+func (q *Queries) GetActiveSessionsForUser(ctx context.Context, userID uuid.UUID) ([]GetActiveSessionsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getActiveSessionsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetActiveSessionsForUserRow
+	for rows.Next() {
+		var i GetActiveSessionsForUserRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.UserAgent,
+			&i.Ip,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.StartedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRefreshToken = `-- name: GetRefreshToken :one
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by_hash, user_agent, ip, last_used_at FROM refresh_tokens WHERE token_hash = $1
+`
+
+func (q *Queries) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedByHash,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const revokeAllSessionsForUser = `-- name: RevokeAllSessionsForUser :exec
 UPDATE refresh_tokens SET revoked_at = NOW(),
 updated_at = NOW()
-WHERE token = $1
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+WHERE user_id = $1 AND revoked_at IS NULL
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, revokeRefreshToken, token)
+func (q *Queries) RevokeAllSessionsForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllSessionsForUser, userID)
+	return err
+}
+
+const revokeRefreshToken = `-- name: RevokeRefreshToken :one
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW(),
+replaced_by_hash = $2
+WHERE token_hash = $1 AND revoked_at IS NULL
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by_hash, user_agent, ip, last_used_at
+`
+
+type RevokeRefreshTokenParams struct {
+	TokenHash      string
+	ReplacedByHash sql.NullString
+}
+
+func (q *Queries) RevokeRefreshToken(ctx context.Context, arg RevokeRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, revokeRefreshToken, arg.TokenHash, arg.ReplacedByHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedByHash,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	FamilyID uuid.UUID
+	UserID   uuid.UUID
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeSession, arg.FamilyID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -7,25 +7,95 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const banUser = `-- name: BanUser :one
+UPDATE users SET banned_at = NOW(),
+token_version = token_version + 1,
+updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, password, failed_login_attempts, locked_until, token_version, banned_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, handle, display_name, bio, avatar_media_id, location, website, deactivated_at
+`
+
+func (q *Queries) BanUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, banUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.Password,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.DeactivatedAt,
+	)
+	return i, err
+}
+
+const bumpTokenVersion = `-- name: BumpTokenVersion :exec
+UPDATE users SET token_version = token_version + 1
+WHERE id = $1
+`
+
+func (q *Queries) BumpTokenVersion(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, bumpTokenVersion, id)
+	return err
+}
+
+const confirmEmailChange = `-- name: ConfirmEmailChange :execrows
+UPDATE users SET email = pending_email,
+pending_email = NULL,
+email_verified_at = NOW(),
+updated_at = NOW()
+WHERE id = $1 AND pending_email = $2
+`
+
+type ConfirmEmailChangeParams struct {
+	ID           uuid.UUID
+	PendingEmail sql.NullString
+}
+
+func (q *Queries) ConfirmEmailChange(ctx context.Context, arg ConfirmEmailChangeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, confirmEmailChange, arg.ID, arg.PendingEmail)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, password)
+INSERT INTO users (id, created_at, updated_at, email, password, handle)
 VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3
 )
-RETURNING id, created_at, updated_at, email, password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, password, failed_login_attempts, locked_until, token_version, banned_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, handle, display_name, bio, avatar_media_id, location, website, deactivated_at
 `
 
 type CreateUserParams struct {
 	Email    string
 	Password string
+	Handle   string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.Password)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.Password, arg.Handle)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -33,11 +103,43 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.Password,
-		&i.IsChirpyRed,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.DeactivatedAt,
 	)
 	return i, err
 }
 
+const deactivateUser = `-- name: DeactivateUser :exec
+UPDATE users SET deactivated_at = $2,
+token_version = token_version + 1,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type DeactivateUserParams struct {
+	ID            uuid.UUID
+	DeactivatedAt sql.NullTime
+}
+
+func (q *Queries) DeactivateUser(ctx context.Context, arg DeactivateUserParams) error {
+	_, err := q.db.ExecContext(ctx, deactivateUser, arg.ID, arg.DeactivatedAt)
+	return err
+}
+
 const deleteAllUsers = `-- name: DeleteAllUsers :exec
 DELETE FROM users
 `
@@ -47,8 +149,106 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const disableTOTP = `-- name: DisableTOTP :exec
+UPDATE users SET totp_secret = NULL,
+totp_enabled_at = NULL,
+totp_last_step = 0,
+updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) DisableTOTP(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableTOTP, id)
+	return err
+}
+
+const enableTOTP = `-- name: EnableTOTP :exec
+UPDATE users SET totp_enabled_at = NOW(),
+totp_last_step = $2,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type EnableTOTPParams struct {
+	ID           uuid.UUID
+	TotpLastStep int64
+}
+
+func (q *Queries) EnableTOTP(ctx context.Context, arg EnableTOTPParams) error {
+	_, err := q.db.ExecContext(ctx, enableTOTP, arg.ID, arg.TotpLastStep)
+	return err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, password, failed_login_attempts, locked_until, token_version, banned_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, handle, display_name, bio, avatar_media_id, location, website, deactivated_at FROM users
+WHERE lower(handle) = lower($1)
+  AND banned_at IS NULL AND deactivated_at IS NULL
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.Password,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.DeactivatedAt,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, password, failed_login_attempts, locked_until, token_version, banned_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, handle, display_name, bio, avatar_media_id, location, website, deactivated_at FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.Password,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.DeactivatedAt,
+	)
+	return i, err
+}
+
 const getUserByMail = `-- name: GetUserByMail :one
-SELECT id, created_at, updated_at, email, password, is_chirpy_red from users where email = $1 ORDER BY created_at ASC LIMIT 1
+SELECT id, created_at, updated_at, email, password, failed_login_attempts, locked_until, token_version, banned_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, handle, display_name, bio, avatar_media_id, location, website, deactivated_at from users where lower(email) = lower($1)
 `
 
 func (q *Queries) GetUserByMail(ctx context.Context, email string) (User, error) {
@@ -60,22 +260,37 @@ func (q *Queries) GetUserByMail(ctx context.Context, email string) (User, error)
 		&i.UpdatedAt,
 		&i.Email,
 		&i.Password,
-		&i.IsChirpyRed,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.DeactivatedAt,
 	)
 	return i, err
 }
 
 const getUserByRefreshToken = `-- name: GetUserByRefreshToken :one
-SELECT u.id, u.created_at, u.updated_at, u.email, u.password, u.is_chirpy_red
+SELECT u.id, u.created_at, u.updated_at, u.email, u.password, u.failed_login_attempts, u.locked_until, u.token_version, u.banned_at, u.totp_secret, u.totp_enabled_at, u.totp_last_step, u.email_verified_at, u.pending_email, u.handle, u.display_name, u.bio, u.avatar_media_id, u.location, u.website, u.deactivated_at
 FROM users u
 JOIN refresh_tokens rt ON rt.user_id = u.id
-WHERE rt.token = $1
+WHERE rt.token_hash = $1
   AND (rt.revoked_at IS NULL)
   AND (rt.expires_at > NOW())
 `
 
-func (q *Queries) GetUserByRefreshToken(ctx context.Context, token string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUserByRefreshToken, token)
+func (q *Queries) GetUserByRefreshToken(ctx context.Context, tokenHash string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByRefreshToken, tokenHash)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -83,26 +298,249 @@ func (q *Queries) GetUserByRefreshToken(ctx context.Context, token string) (User
 		&i.UpdatedAt,
 		&i.Email,
 		&i.Password,
-		&i.IsChirpyRed,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.DeactivatedAt,
 	)
 	return i, err
 }
 
-const updateUser = `-- name: UpdateUser :one
-UPDATE users SET email=$2, password = $3,
+const getUserTokenVersion = `-- name: GetUserTokenVersion :one
+SELECT token_version FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, getUserTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
+const getUsersToPurge = `-- name: GetUsersToPurge :many
+SELECT id FROM users WHERE deactivated_at < $1
+`
+
+func (q *Queries) GetUsersToPurge(ctx context.Context, deactivatedAt sql.NullTime) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersToPurge, deactivatedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockUser = `-- name: LockUser :exec
+UPDATE users SET failed_login_attempts = 0, locked_until = $2
+WHERE id = $1
+`
+
+type LockUserParams struct {
+	ID          uuid.UUID
+	LockedUntil sql.NullTime
+}
+
+func (q *Queries) LockUser(ctx context.Context, arg LockUserParams) error {
+	_, err := q.db.ExecContext(ctx, lockUser, arg.ID, arg.LockedUntil)
+	return err
+}
+
+const purgeUser = `-- name: PurgeUser :execrows
+DELETE FROM users WHERE id = $1 AND deactivated_at < $2
+`
+
+type PurgeUserParams struct {
+	ID            uuid.UUID
+	DeactivatedAt sql.NullTime
+}
+
+func (q *Queries) PurgeUser(ctx context.Context, arg PurgeUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeUser, arg.ID, arg.DeactivatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const reactivateUser = `-- name: ReactivateUser :exec
+UPDATE users SET deactivated_at = NULL,
 updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, password, is_chirpy_red
 `
 
-type UpdateUserParams struct {
+func (q *Queries) ReactivateUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, reactivateUser, id)
+	return err
+}
+
+const recordFailedLogin = `-- name: RecordFailedLogin :one
+UPDATE users SET failed_login_attempts = failed_login_attempts + 1
+WHERE id = $1
+RETURNING failed_login_attempts
+`
+
+func (q *Queries) RecordFailedLogin(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, recordFailedLogin, id)
+	var failed_login_attempts int32
+	err := row.Scan(&failed_login_attempts)
+	return failed_login_attempts, err
+}
+
+const recordTOTPStep = `-- name: RecordTOTPStep :execrows
+UPDATE users SET totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2
+`
+
+type RecordTOTPStepParams struct {
+	ID           uuid.UUID
+	TotpLastStep int64
+}
+
+func (q *Queries) RecordTOTPStep(ctx context.Context, arg RecordTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, recordTOTPStep, arg.ID, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rehashPassword = `-- name: RehashPassword :exec
+UPDATE users SET password = $2
+WHERE id = $1
+`
+
+type RehashPasswordParams struct {
+	ID       uuid.UUID
+	Password string
+}
+
+func (q *Queries) RehashPassword(ctx context.Context, arg RehashPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashPassword, arg.ID, arg.Password)
+	return err
+}
+
+const resetPassword = `-- name: ResetPassword :exec
+UPDATE users SET password = $2,
+token_version = token_version + 1,
+failed_login_attempts = 0,
+locked_until = NULL,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type ResetPasswordParams struct {
 	ID       uuid.UUID
-	Email    string
 	Password string
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Email, arg.Password)
+func (q *Queries) ResetPassword(ctx context.Context, arg ResetPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, resetPassword, arg.ID, arg.Password)
+	return err
+}
+
+const setPendingEmail = `-- name: SetPendingEmail :exec
+UPDATE users SET pending_email = $2,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type SetPendingEmailParams struct {
+	ID           uuid.UUID
+	PendingEmail sql.NullString
+}
+
+func (q *Queries) SetPendingEmail(ctx context.Context, arg SetPendingEmailParams) error {
+	_, err := q.db.ExecContext(ctx, setPendingEmail, arg.ID, arg.PendingEmail)
+	return err
+}
+
+const setTOTPSecret = `-- name: SetTOTPSecret :exec
+UPDATE users SET totp_secret = $2,
+totp_enabled_at = NULL,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type SetTOTPSecretParams struct {
+	ID         uuid.UUID
+	TotpSecret sql.NullString
+}
+
+func (q *Queries) SetTOTPSecret(ctx context.Context, arg SetTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, setTOTPSecret, arg.ID, arg.TotpSecret)
+	return err
+}
+
+const unbanUser = `-- name: UnbanUser :one
+UPDATE users SET banned_at = NULL,
+updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, password, failed_login_attempts, locked_until, token_version, banned_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, handle, display_name, bio, avatar_media_id, location, website, deactivated_at
+`
+
+func (q *Queries) UnbanUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, unbanUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.Password,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.DeactivatedAt,
+	)
+	return i, err
+}
+
+const unlockUser = `-- name: UnlockUser :one
+UPDATE users SET failed_login_attempts = 0, locked_until = NULL
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, password, failed_login_attempts, locked_until, token_version, banned_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, handle, display_name, bio, avatar_media_id, location, website, deactivated_at
+`
+
+func (q *Queries) UnlockUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, unlockUser, id)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -110,20 +548,58 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.Password,
-		&i.IsChirpyRed,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.DeactivatedAt,
 	)
 	return i, err
 }
 
-const upgradeUser = `-- name: UpgradeUser :one
-UPDATE users SET is_chirpy_red = TRUE,
+const updateProfile = `-- name: UpdateProfile :one
+UPDATE users SET handle = $2,
+display_name = $3,
+bio = $4,
+avatar_media_id = $5,
+location = $6,
+website = $7,
 updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, password, failed_login_attempts, locked_until, token_version, banned_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, handle, display_name, bio, avatar_media_id, location, website, deactivated_at
 `
 
-func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) (User, error) {
-	row := q.db.QueryRowContext(ctx, upgradeUser, id)
+type UpdateProfileParams struct {
+	ID            uuid.UUID
+	Handle        string
+	DisplayName   string
+	Bio           string
+	AvatarMediaID uuid.NullUUID
+	Location      string
+	Website       string
+}
+
+func (q *Queries) UpdateProfile(ctx context.Context, arg UpdateProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateProfile,
+		arg.ID,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarMediaID,
+		arg.Location,
+		arg.Website,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -131,7 +607,41 @@ func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.UpdatedAt,
 		&i.Email,
 		&i.Password,
-		&i.IsChirpyRed,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.DeactivatedAt,
 	)
 	return i, err
 }
+
+const verifyUserEmail = `-- name: VerifyUserEmail :execrows
+UPDATE users SET email_verified_at = NOW(),
+updated_at = NOW()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
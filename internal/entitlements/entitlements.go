@@ -0,0 +1,110 @@
+// Package entitlements maps subscription plans to what they unlock, so
+// handlers ask what a user may do rather than which plan they are on.
+package entitlements
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Free is the plan of users without an active subscription. Every Table
+// has an entry for it.
+const Free = "free"
+
+// Entitlements is what one plan unlocks.
+type Entitlements struct {
+	// MaxChirpLength is in bytes.
+	MaxChirpLength int  `json:"max_chirp_length"`
+	EditChirps     bool `json:"edit_chirps"`
+	MediaSlots     int  `json:"media_slots"`
+	// RateLimitMultiplier scales the limit of every per-user rate limit.
+	RateLimitMultiplier float64 `json:"rate_limit_multiplier"`
+}
+
+// ScaleLimit applies the rate limit multiplier to limit, never going below
+// one request.
+func (e Entitlements) ScaleLimit(limit int) int {
+	return max(1, int(math.Round(float64(limit)*e.RateLimitMultiplier)))
+}
+
+func (e Entitlements) validate() error {
+	if e.MaxChirpLength <= 0 {
+		return fmt.Errorf("max_chirp_length must be positive")
+	}
+	if e.MediaSlots < 0 {
+		return fmt.Errorf("media_slots can't be negative")
+	}
+	if e.RateLimitMultiplier <= 0 {
+		return fmt.Errorf("rate_limit_multiplier must be positive")
+	}
+	return nil
+}
+
+// Table holds the entitlements of each plan by name.
+type Table map[string]Entitlements
+
+// Default returns the built-in plans.
+func Default() Table {
+	return Table{
+		Free: {
+			MaxChirpLength:      140,
+			MediaSlots:          1,
+			RateLimitMultiplier: 1,
+		},
+		"chirpy_red": {
+			MaxChirpLength:      1000,
+			EditChirps:          true,
+			MediaSlots:          4,
+			RateLimitMultiplier: 3,
+		},
+	}
+}
+
+// For returns the entitlements of plan, or of the free plan if plan is
+// unknown.
+func (t Table) For(plan string) Entitlements {
+	if e, ok := t[plan]; ok {
+		return e
+	}
+	return t[Free]
+}
+
+// Load reads a JSON object mapping plan names to entitlements and applies
+// it on top of Default. Fields a plan leaves out keep their default, or
+// the free plan's value for plans that aren't built in.
+func Load(r io.Reader) (Table, error) {
+	var plans map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&plans); err != nil {
+		return nil, err
+	}
+	t := Default()
+	// The free plan goes first so new plans build on the configured one.
+	if raw, ok := plans[Free]; ok {
+		if err := t.apply(Free, raw); err != nil {
+			return nil, err
+		}
+	}
+	for plan, raw := range plans {
+		if plan == Free {
+			continue
+		}
+		if err := t.apply(plan, raw); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t Table) apply(plan string, raw json.RawMessage) error {
+	e := t.For(plan)
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return fmt.Errorf("plan %q: %w", plan, err)
+	}
+	if err := e.validate(); err != nil {
+		return fmt.Errorf("plan %q: %w", plan, err)
+	}
+	t[plan] = e
+	return nil
+}
@@ -0,0 +1,81 @@
+package entitlements
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFor(t *testing.T) {
+	table := Default()
+	if got := table.For("chirpy_red"); !got.EditChirps {
+		t.Errorf("For(chirpy_red).EditChirps = false, want true")
+	}
+	if got, want := table.For("no_such_plan"), table[Free]; got != want {
+		t.Errorf("For(no_such_plan) = %+v, want free plan %+v", got, want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	input := `{
+		"free": {"max_chirp_length": 200},
+		"chirpy_red": {"rate_limit_multiplier": 5},
+		"chirpy_blue": {"edit_chirps": true}
+	}`
+	table, err := Load(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := table[Free].MaxChirpLength; got != 200 {
+		t.Errorf("free MaxChirpLength = %d, want 200", got)
+	}
+	if got := table[Free].RateLimitMultiplier; got != 1 {
+		t.Errorf("free RateLimitMultiplier = %v, want default 1", got)
+	}
+	red := table["chirpy_red"]
+	if red.RateLimitMultiplier != 5 || red.MaxChirpLength != 1000 || !red.EditChirps {
+		t.Errorf("chirpy_red = %+v, want defaults with multiplier 5", red)
+	}
+	blue := table["chirpy_blue"]
+	if !blue.EditChirps || blue.MaxChirpLength != 200 {
+		t.Errorf("chirpy_blue = %+v, want configured free plan plus edit rights", blue)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"Not JSON", `plans`},
+		{"Zero chirp length", `{"free": {"max_chirp_length": 0}}`},
+		{"Negative media slots", `{"chirpy_red": {"media_slots": -1}}`},
+		{"Zero multiplier", `{"chirpy_red": {"rate_limit_multiplier": 0}}`},
+		{"Wrong type", `{"chirpy_red": {"edit_chirps": "yes"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(strings.NewReader(tt.input)); err == nil {
+				t.Errorf("Load(%s) error = nil, want error", tt.input)
+			}
+		})
+	}
+}
+
+func TestScaleLimit(t *testing.T) {
+	tests := []struct {
+		multiplier float64
+		limit      int
+		want       int
+	}{
+		{1, 30, 30},
+		{3, 30, 90},
+		{0.5, 5, 3},
+		{0.01, 10, 1},
+	}
+	for _, tt := range tests {
+		e := Entitlements{RateLimitMultiplier: tt.multiplier}
+		if got := e.ScaleLimit(tt.limit); got != tt.want {
+			t.Errorf("ScaleLimit(%d) with multiplier %v = %d, want %d", tt.limit, tt.multiplier, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Package importer reads chirp archives from other services, or from
+// Chirpy's own JSON Lines format, and fits their entries into Chirpy's
+// length limit.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// Entry is one post read from an archive.
+type Entry struct {
+	CreatedAt time.Time
+	Body      string
+}
+
+// Format names an archive format.
+type Format string
+
+const (
+	// FormatTweets is the tweets.js file from a Twitter/X data export.
+	FormatTweets Format = "tweets"
+	// FormatJSONL has one {"body": ..., "created_at": RFC 3339} object per
+	// line.
+	FormatJSONL Format = "jsonl"
+)
+
+// twitterTime is the layout of created_at in tweets.js.
+const twitterTime = "Mon Jan 02 15:04:05 -0700 2006"
+
+// Parse reads every entry in an archive. An empty format is detected from
+// the content.
+func Parse(r io.Reader, format Format) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = FormatJSONL
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("window.")) {
+			format = FormatTweets
+		}
+	}
+	switch format {
+	case FormatTweets:
+		return parseTweets(data)
+	case FormatJSONL:
+		return parseJSONL(data)
+	}
+	return nil, fmt.Errorf("unknown archive format %q", format)
+}
+
+// parseTweets reads tweets.js, which is a JSON array assigned to a
+// JavaScript variable: window.YTD.tweets.part0 = [{"tweet": {...}}, ...].
+func parseTweets(data []byte) ([]Entry, error) {
+	start := bytes.IndexByte(data, '[')
+	if start < 0 {
+		return nil, errors.New("tweets.js: no tweet array found")
+	}
+	var items []struct {
+		Tweet struct {
+			FullText  string `json:"full_text"`
+			CreatedAt string `json:"created_at"`
+		} `json:"tweet"`
+	}
+	if err := json.Unmarshal(data[start:], &items); err != nil {
+		return nil, fmt.Errorf("tweets.js: %w", err)
+	}
+
+	entries := make([]Entry, 0, len(items))
+	for i, item := range items {
+		createdAt, err := time.Parse(twitterTime, item.Tweet.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("tweets.js: tweet %d: %w", i+1, err)
+		}
+		entries = append(entries, Entry{
+			CreatedAt: createdAt.UTC(),
+			// Twitter escapes &, < and > in exported text.
+			Body: html.UnescapeString(item.Tweet.FullText),
+		})
+	}
+	return entries, nil
+}
+
+func parseJSONL(data []byte) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var item struct {
+			Body      string    `json:"body"`
+			CreatedAt time.Time `json:"created_at"`
+		}
+		if err := json.Unmarshal(text, &item); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if item.CreatedAt.IsZero() {
+			return nil, fmt.Errorf("line %d: created_at is required", line)
+		}
+		entries = append(entries, Entry{CreatedAt: item.CreatedAt.UTC(), Body: item.Body})
+	}
+	return entries, scanner.Err()
+}
+
+// Mode decides what happens to entries longer than the limit.
+type Mode string
+
+const (
+	// ModeSplit turns a long entry into a thread of consecutive chirps.
+	ModeSplit Mode = "split"
+	// ModeTruncate keeps as much of a long entry as fits.
+	ModeTruncate Mode = "truncate"
+)
+
+// Fit breaks body into pieces of at most limit bytes, the way createChirp
+// measures chirps, preferring to break between words. With ModeTruncate
+// only the first piece is returned.
+func Fit(body string, limit int, mode Mode) []string {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil
+	}
+	var pieces []string
+	for len(body) > limit {
+		cut := breakPoint(body, limit)
+		pieces = append(pieces, strings.TrimSpace(body[:cut]))
+		if mode == ModeTruncate {
+			return pieces
+		}
+		body = strings.TrimSpace(body[cut:])
+	}
+	return append(pieces, body)
+}
+
+// breakPoint returns where to end a piece of at most limit bytes: after the
+// last space that fits, or failing that at the last whole character.
+func breakPoint(s string, limit int) int {
+	if i := strings.LastIndexAny(s[:limit+1], " \n\t"); i > 0 {
+		return i
+	}
+	cut := limit
+	// Back up to the start of a UTF-8 sequence.
+	for cut > 0 && s[cut]&0xC0 == 0x80 {
+		cut--
+	}
+	if cut == 0 {
+		return limit
+	}
+	return cut
+}
@@ -0,0 +1,104 @@
+package importer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const tweetsJS = `window.YTD.tweets.part0 = [
+  {
+    "tweet" : {
+      "id_str" : "1",
+      "full_text" : "Fish &amp; chips",
+      "created_at" : "Wed Oct 10 20:19:24 +0000 2018"
+    }
+  },
+  {
+    "tweet" : {
+      "id_str" : "2",
+      "full_text" : "second",
+      "created_at" : "Thu Oct 11 08:00:00 +0200 2018"
+    }
+  }
+]`
+
+func TestParseTweets(t *testing.T) {
+	entries, err := Parse(strings.NewReader(tweetsJS), "")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []Entry{
+		{CreatedAt: time.Date(2018, 10, 10, 20, 19, 24, 0, time.UTC), Body: "Fish & chips"},
+		{CreatedAt: time.Date(2018, 10, 11, 6, 0, 0, 0, time.UTC), Body: "second"},
+	}
+	if !slices.Equal(entries, want) {
+		t.Errorf("Parse() = %v, want %v", entries, want)
+	}
+}
+
+func TestParseJSONL(t *testing.T) {
+	input := `{"body": "hello", "created_at": "2024-05-01T12:00:00Z"}
+
+{"body": "world", "created_at": "2024-05-01T14:00:00+02:00"}
+`
+	entries, err := Parse(strings.NewReader(input), FormatJSONL)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []Entry{
+		{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Body: "hello"},
+		{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Body: "world"},
+	}
+	if !slices.Equal(entries, want) {
+		t.Errorf("Parse() = %v, want %v", entries, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		format Format
+	}{
+		{"bad JSON line", "{\"body\": \"ok\", \"created_at\": \"2024-05-01T12:00:00Z\"}\nnot json\n", FormatJSONL},
+		{"missing timestamp", `{"body": "hi"}`, FormatJSONL},
+		{"no array", "window.YTD.tweets.part0 = ", FormatTweets},
+		{"bad tweet date", `window.YTD.tweets.part0 = [{"tweet": {"full_text": "x", "created_at": "yesterday"}}]`, FormatTweets},
+		{"unknown format", "", "csv"},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(strings.NewReader(tt.input), tt.format); err == nil {
+			t.Errorf("%s: Parse() should have failed", tt.name)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		limit int
+		mode  Mode
+		want  []string
+	}{
+		{"short", "  hello  ", 10, ModeSplit, []string{"hello"}},
+		{"empty", "   ", 10, ModeSplit, nil},
+		{"split on words", "one two three four", 9, ModeSplit, []string{"one two", "three", "four"}},
+		{"truncate", "one two three four", 9, ModeTruncate, []string{"one two"}},
+		{"long word", "abcdefghij", 4, ModeSplit, []string{"abcd", "efgh", "ij"}},
+		{"multibyte", "ééééé", 5, ModeSplit, []string{"éé", "éé", "é"}},
+	}
+	for _, tt := range tests {
+		got := Fit(tt.body, tt.limit, tt.mode)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Fit() = %q, want %q", tt.name, got, tt.want)
+		}
+		for _, piece := range got {
+			if len(piece) > tt.limit {
+				t.Errorf("%s: piece %q is longer than %d bytes", tt.name, piece, tt.limit)
+			}
+		}
+	}
+}
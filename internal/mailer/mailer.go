@@ -0,0 +1,113 @@
+// Package mailer sends transactional email through a pluggable Mailer, so
+// production can deliver over SMTP while development and tests just record
+// what would have been sent.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// validate rejects messages that could inject extra headers.
+func (m Message) validate() error {
+	if m.To == "" {
+		return fmt.Errorf("message has no recipient")
+	}
+	if strings.ContainsAny(m.To+m.Subject, "\r\n") {
+		return fmt.Errorf("message headers contain a line break")
+	}
+	return nil
+}
+
+// bytes renders the message as RFC 5322 text.
+func (m Message) bytes(from string, date time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// SMTPMailer delivers mail through an SMTP relay. The connection is upgraded
+// with STARTTLS when the server offers it, and Auth, if set, is only used
+// over TLS or to localhost, as net/smtp enforces.
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// NewSMTPMailer returns a mailer for the relay at addr (host:port). PLAIN
+// authentication is used when username is not empty.
+func NewSMTPMailer(addr, from, username, password string) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP address: %w", err)
+	}
+	m := &SMTPMailer{Addr: addr, From: from}
+	if username != "" {
+		m.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	// net/smtp has no context support, so only honour cancellation before
+	// the connection is made.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, msg.bytes(m.From, time.Now()))
+}
+
+// WriterMailer writes every message to W instead of sending it. Pointed at
+// os.Stdout it logs mail during development; pointed at a file it keeps a
+// transcript.
+type WriterMailer struct {
+	W    io.Writer
+	From string
+
+	mu sync.Mutex
+}
+
+func NewWriterMailer(w io.Writer, from string) *WriterMailer {
+	return &WriterMailer{W: w, From: from}
+}
+
+func (m *WriterMailer) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.W, "----- mail -----\r\n%s\r\n----- end mail -----\r\n", msg.bytes(m.From, time.Now()))
+	return err
+}
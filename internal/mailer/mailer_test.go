@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageBytes(t *testing.T) {
+	msg := Message{To: "user@example.com", Subject: "Hello", Body: "line one\nline two"}
+	date := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	got := string(msg.bytes("chirpy@example.com", date))
+
+	for _, want := range []string{
+		"From: chirpy@example.com\r\n",
+		"To: user@example.com\r\n",
+		"Subject: Hello\r\n",
+		"Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestWriterMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewWriterMailer(&buf, "chirpy@example.com")
+
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Verify", Body: "https://example.com/verify"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "https://example.com/verify") {
+		t.Errorf("output missing body:\n%s", buf.String())
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	m := NewWriterMailer(&bytes.Buffer{}, "chirpy@example.com")
+	tests := []Message{
+		{To: "", Subject: "Hi"},
+		{To: "user@example.com\r\nBcc: victim@example.com", Subject: "Hi"},
+		{To: "user@example.com", Subject: "Hi\nBcc: victim@example.com"},
+	}
+	for _, msg := range tests {
+		if err := m.Send(context.Background(), msg); err == nil {
+			t.Errorf("Send(%q, %q) should have failed", msg.To, msg.Subject)
+		}
+	}
+}
+
+func TestNewSMTPMailer(t *testing.T) {
+	if _, err := NewSMTPMailer("no-port", "chirpy@example.com", "", ""); err == nil {
+		t.Error("NewSMTPMailer() should reject an address without a port")
+	}
+	m, err := NewSMTPMailer("smtp.example.com:587", "chirpy@example.com", "user", "pass")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error = %v", err)
+	}
+	if m.Auth == nil {
+		t.Error("NewSMTPMailer() should set up authentication when a username is given")
+	}
+}
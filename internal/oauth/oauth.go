@@ -0,0 +1,88 @@
+// Package oauth implements an OAuth 2.0 authorization server for third-party
+// clients: the authorization code grant with mandatory PKCE (RFC 6749,
+// RFC 7636), refresh tokens, and token revocation (RFC 7009).
+//
+// Access tokens are ordinary Chirpy JWTs carrying the client ID and granted
+// scopes, so resource handlers validate them the same way as first-party
+// tokens.
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned by a Store when a record doesn't exist or, for
+// codes and refresh tokens, has already been used.
+var ErrNotFound = errors.New("oauth: not found")
+
+// Client is a registered third-party application. Public clients (such as
+// mobile or single-page apps) have no secret and rely on PKCE alone.
+type Client struct {
+	ID           uuid.UUID
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   string
+	RedirectURIs []string
+	CreatedAt    time.Time
+}
+
+// Confidential reports whether the client has to authenticate with a secret.
+func (c Client) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+// AuthorizationCode is a single-use code handed to the client after the user
+// consents, to be exchanged for tokens.
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectURI   string
+	Scope         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+// RefreshToken lets a client obtain new access tokens without the user.
+type RefreshToken struct {
+	TokenHash string
+	ClientID  uuid.UUID
+	UserID    uuid.UUID
+	Scope     string
+	ExpiresAt time.Time
+}
+
+// Store persists clients, codes and refresh tokens. Secrets are only ever
+// passed to it hashed.
+type Store interface {
+	CreateClient(ctx context.Context, client Client) error
+	GetClient(ctx context.Context, id uuid.UUID) (Client, error)
+	CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) error
+	// ConsumeAuthorizationCode marks a code as used and returns it. It must
+	// be atomic so a code can't be redeemed twice.
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error)
+	CreateRefreshToken(ctx context.Context, token RefreshToken) error
+	// ConsumeRefreshToken revokes a refresh token and returns it. It must be
+	// atomic so a token can't be rotated twice.
+	ConsumeRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+	// RevokeRefreshToken revokes a refresh token issued to clientID. Unknown
+	// tokens are not an error.
+	RevokeRefreshToken(ctx context.Context, tokenHash string, clientID uuid.UUID) error
+}
+
+// verifyPKCE checks an S256 code verifier against the stored challenge.
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,394 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// memoryStore is a Store for tests.
+type memoryStore struct {
+	mu      sync.Mutex
+	clients map[uuid.UUID]Client
+	codes   map[string]AuthorizationCode
+	tokens  map[string]RefreshToken
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		clients: map[uuid.UUID]Client{},
+		codes:   map[string]AuthorizationCode{},
+		tokens:  map[string]RefreshToken{},
+	}
+}
+
+func (m *memoryStore) CreateClient(ctx context.Context, client Client) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clients[client.ID] = client
+	return nil
+}
+
+func (m *memoryStore) GetClient(ctx context.Context, id uuid.UUID) (Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.clients[id]
+	if !ok {
+		return Client{}, ErrNotFound
+	}
+	return client, nil
+}
+
+func (m *memoryStore) CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code.CodeHash] = code
+	return nil
+}
+
+func (m *memoryStore) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.codes[codeHash]
+	if !ok {
+		return AuthorizationCode{}, ErrNotFound
+	}
+	delete(m.codes, codeHash)
+	return code, nil
+}
+
+func (m *memoryStore) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (m *memoryStore) ConsumeRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.tokens[tokenHash]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+	delete(m.tokens, tokenHash)
+	return token, nil
+}
+
+func (m *memoryStore) RevokeRefreshToken(ctx context.Context, tokenHash string, clientID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if token, ok := m.tokens[tokenHash]; ok && token.ClientID == clientID {
+		delete(m.tokens, tokenHash)
+	}
+	return nil
+}
+
+const redirectURI = "https://bot.example.com/callback"
+
+type testEnv struct {
+	t      *testing.T
+	server *httptest.Server
+	keys   *auth.KeyRing
+	userID uuid.UUID
+}
+
+// newTestEnv serves the OAuth endpoints. Users sign in by sending their ID
+// as a bearer token.
+func newTestEnv(t *testing.T) *testEnv {
+	key, err := auth.GenerateEd25519Key("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := auth.NewKeyRing(key)
+	authenticate := func(r *http.Request) (uuid.UUID, error) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		return uuid.Parse(token)
+	}
+	tokenVersion := func(ctx context.Context, userID uuid.UUID) (int32, error) { return 7, nil }
+
+	srv := httptest.NewServer(NewServer(newMemoryStore(), keys, authenticate, tokenVersion))
+	t.Cleanup(srv.Close)
+	return &testEnv{t: t, server: srv, keys: keys, userID: uuid.New()}
+}
+
+func (e *testEnv) do(method, path string, body url.Values, jsonBody any, bearer string) (*http.Response, map[string]any) {
+	e.t.Helper()
+	var req *http.Request
+	var err error
+	switch {
+	case jsonBody != nil:
+		data, _ := json.Marshal(jsonBody)
+		req, err = http.NewRequest(method, e.server.URL+path, strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+	case body != nil:
+		req, err = http.NewRequest(method, e.server.URL+path, strings.NewReader(body.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	default:
+		req, err = http.NewRequest(method, e.server.URL+path, nil)
+	}
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	out := map[string]any{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp, out
+}
+
+func (e *testEnv) registerClient(confidential bool) (string, string) {
+	e.t.Helper()
+	resp, body := e.do("POST", "/oauth/clients", nil, map[string]any{
+		"client_name":   "Test Bot",
+		"redirect_uris": []string{redirectURI},
+		"confidential":  confidential,
+	}, e.userID.String())
+	if resp.StatusCode != http.StatusCreated {
+		e.t.Fatalf("register status = %d, body = %v", resp.StatusCode, body)
+	}
+	secret, _ := body["client_secret"].(string)
+	return body["client_id"].(string), secret
+}
+
+func pkce(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func authorizeParams(clientID string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"chirps:read chirps:write"},
+		"state":                 {"xyz"},
+		"code_challenge":        {pkce(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+// approve walks through consent and returns the authorization code.
+func (e *testEnv) approve(clientID string) string {
+	e.t.Helper()
+	params := authorizeParams(clientID)
+	params.Set("decision", "approve")
+	resp, body := e.do("POST", "/oauth/authorize", params, nil, e.userID.String())
+	if resp.StatusCode != http.StatusOK {
+		e.t.Fatalf("consent status = %d, body = %v", resp.StatusCode, body)
+	}
+	redirect, err := url.Parse(body["redirect_to"].(string))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if redirect.Query().Get("state") != "xyz" {
+		e.t.Errorf("state = %q, want xyz", redirect.Query().Get("state"))
+	}
+	return redirect.Query().Get("code")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	env := newTestEnv(t)
+	clientID, _ := env.registerClient(false)
+
+	resp, body := env.do("GET", "/oauth/authorize?"+authorizeParams(clientID).Encode(), nil, nil, env.userID.String())
+	if resp.StatusCode != http.StatusOK || body["client_name"] != "Test Bot" {
+		t.Fatalf("authorize status = %d, body = %v", resp.StatusCode, body)
+	}
+
+	code := env.approve(clientID)
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {clientID},
+		"code_verifier": {verifier},
+	}
+	resp, body = env.do("POST", "/oauth/token", exchange, nil, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("token status = %d, body = %v", resp.StatusCode, body)
+	}
+	if body["token_type"] != "Bearer" || body["scope"] != "chirps:read chirps:write" {
+		t.Errorf("unexpected token response %v", body)
+	}
+
+	accessToken := body["access_token"].(string)
+	userID, err := auth.ValidateJWT(accessToken, env.keys, func(uuid.UUID) (int32, error) { return 7, nil })
+	if err != nil || userID != env.userID {
+		t.Fatalf("ValidateJWT() = %v, %v, want %v", userID, err, env.userID)
+	}
+	claims, _ := auth.ParseJWT(accessToken, env.keys, nil)
+	if claims.ClientID != clientID || len(claims.Scopes()) != 2 {
+		t.Errorf("claims = %+v, want client %s with 2 scopes", claims, clientID)
+	}
+
+	resp, body = env.do("POST", "/oauth/token", exchange, nil, "")
+	if resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("code reuse status = %d, body = %v", resp.StatusCode, body)
+	}
+}
+
+func TestRefreshAndRevoke(t *testing.T) {
+	env := newTestEnv(t)
+	clientID, secret := env.registerClient(true)
+	if secret == "" {
+		t.Fatal("confidential client has no secret")
+	}
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {env.approve(clientID)},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {clientID},
+		"code_verifier": {verifier},
+	}
+	resp, body := env.do("POST", "/oauth/token", exchange, nil, "")
+	if resp.StatusCode != http.StatusUnauthorized || body["error"] != "invalid_client" {
+		t.Fatalf("token without secret status = %d, body = %v", resp.StatusCode, body)
+	}
+	exchange.Set("client_secret", secret)
+	_, body = env.do("POST", "/oauth/token", exchange, nil, "")
+	refreshToken := body["refresh_token"].(string)
+
+	refresh := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"scope":         {"chirps:read"},
+		"client_id":     {clientID},
+		"client_secret": {secret},
+	}
+	resp, body = env.do("POST", "/oauth/token", refresh, nil, "")
+	if resp.StatusCode != http.StatusOK || body["scope"] != "chirps:read" {
+		t.Fatalf("refresh status = %d, body = %v", resp.StatusCode, body)
+	}
+	rotated := body["refresh_token"].(string)
+
+	resp, _ = env.do("POST", "/oauth/token", refresh, nil, "")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("reused refresh token status = %d, want 400", resp.StatusCode)
+	}
+
+	refresh.Set("refresh_token", rotated)
+	refresh.Set("scope", "chirps:write")
+	resp, body = env.do("POST", "/oauth/token", refresh, nil, "")
+	if resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_scope" {
+		t.Errorf("widened scope status = %d, body = %v", resp.StatusCode, body)
+	}
+
+	// The failed attempt above consumed the token; get a fresh one to revoke.
+	exchange.Set("code", env.approve(clientID))
+	_, body = env.do("POST", "/oauth/token", exchange, nil, "")
+	refreshToken = body["refresh_token"].(string)
+
+	revoke := url.Values{"token": {refreshToken}, "client_id": {clientID}, "client_secret": {secret}}
+	resp, _ = env.do("POST", "/oauth/revoke", revoke, nil, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("revoke status = %d", resp.StatusCode)
+	}
+	refresh.Set("refresh_token", refreshToken)
+	refresh.Del("scope")
+	resp, _ = env.do("POST", "/oauth/token", refresh, nil, "")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("revoked refresh token status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestPKCEIsEnforced(t *testing.T) {
+	env := newTestEnv(t)
+	clientID, _ := env.registerClient(false)
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {env.approve(clientID)},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {clientID},
+		"code_verifier": {strings.Repeat("a", 43)},
+	}
+	resp, body := env.do("POST", "/oauth/token", exchange, nil, "")
+	if resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("wrong verifier status = %d, body = %v", resp.StatusCode, body)
+	}
+
+	params := authorizeParams(clientID)
+	params.Del("code_challenge")
+	resp, body = env.do("GET", "/oauth/authorize?"+params.Encode(), nil, nil, env.userID.String())
+	if resp.StatusCode != http.StatusBadRequest || !strings.HasPrefix(body["redirect_to"].(string), redirectURI) {
+		t.Errorf("missing challenge status = %d, body = %v", resp.StatusCode, body)
+	}
+}
+
+func TestAuthorizeRejectsUnregisteredRedirect(t *testing.T) {
+	env := newTestEnv(t)
+	clientID, _ := env.registerClient(false)
+
+	params := authorizeParams(clientID)
+	params.Set("redirect_uri", "https://evil.example.com/callback")
+	resp, body := env.do("GET", "/oauth/authorize?"+params.Encode(), nil, nil, env.userID.String())
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+	if _, ok := body["redirect_to"]; ok {
+		t.Error("error for an unregistered redirect URI must not redirect")
+	}
+}
+
+func TestDenyConsent(t *testing.T) {
+	env := newTestEnv(t)
+	clientID, _ := env.registerClient(false)
+
+	params := authorizeParams(clientID)
+	params.Set("decision", "deny")
+	_, body := env.do("POST", "/oauth/authorize", params, nil, env.userID.String())
+	redirect, _ := url.Parse(body["redirect_to"].(string))
+	if redirect.Query().Get("error") != "access_denied" || redirect.Query().Get("code") != "" {
+		t.Errorf("redirect_to = %s, want access_denied without a code", redirect)
+	}
+}
+
+func TestConsentRequiresLogin(t *testing.T) {
+	env := newTestEnv(t)
+	clientID, _ := env.registerClient(false)
+
+	resp, _ := env.do("GET", "/oauth/authorize?"+authorizeParams(clientID).Encode(), nil, nil, "")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	tests := map[string]bool{
+		"https://app.example.com/cb":   true,
+		"http://localhost:3000/cb":     true,
+		"http://127.0.0.1/cb":          true,
+		"http://app.example.com/cb":    false,
+		"https://app.example.com/cb#x": false,
+		"/relative":                    false,
+		"javascript:alert(1)":          false,
+	}
+	for uri, want := range tests {
+		if got := validRedirectURI(uri); got != want {
+			t.Errorf("validRedirectURI(%q) = %v, want %v", uri, got, want)
+		}
+	}
+}
@@ -0,0 +1,508 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+const (
+	AccessTokenTTL  = time.Hour
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	codeTTL         = 5 * time.Minute
+
+	maxClientNameLength = 100
+)
+
+// Server serves the OAuth endpoints under /oauth/.
+type Server struct {
+	store Store
+	keys  *auth.KeyRing
+	// authenticate identifies the signed-in user registering a client or
+	// answering a consent prompt.
+	authenticate func(r *http.Request) (uuid.UUID, error)
+	// tokenVersion returns the user's token version, so that access tokens
+	// issued to clients are invalidated along with first-party ones.
+	tokenVersion func(ctx context.Context, userID uuid.UUID) (int32, error)
+	now          func() time.Time
+	mux          *http.ServeMux
+}
+
+func NewServer(
+	store Store,
+	keys *auth.KeyRing,
+	authenticate func(r *http.Request) (uuid.UUID, error),
+	tokenVersion func(ctx context.Context, userID uuid.UUID) (int32, error),
+) *Server {
+	s := &Server{
+		store:        store,
+		keys:         keys,
+		authenticate: authenticate,
+		tokenVersion: tokenVersion,
+		now:          time.Now,
+		mux:          http.NewServeMux(),
+	}
+	s.mux.HandleFunc("POST /oauth/clients", s.registerClient)
+	s.mux.HandleFunc("GET /oauth/authorize", s.authorize)
+	s.mux.HandleFunc("POST /oauth/authorize", s.consent)
+	s.mux.HandleFunc("POST /oauth/token", s.token)
+	s.mux.HandleFunc("POST /oauth/revoke", s.revoke)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Error is an OAuth error response (RFC 6749 section 5.2).
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	// RedirectTo is set on authorization errors that should be reported
+	// back to the client rather than shown to the user.
+	RedirectTo string `json:"redirect_to,omitempty"`
+	status     int
+}
+
+func newError(status int, code, description string) *Error {
+	return &Error{Code: code, Description: description, status: status}
+}
+
+func writeError(w http.ResponseWriter, e *Error) {
+	if e.status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	writeJSON(w, e.status, e)
+}
+
+func writeJSON(w http.ResponseWriter, code int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(dat)
+}
+
+func (s *Server) registerClient(w http.ResponseWriter, r *http.Request) {
+	type registration struct {
+		Name         string   `json:"client_name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+	type response struct {
+		ClientID     uuid.UUID `json:"client_id"`
+		ClientSecret string    `json:"client_secret,omitempty"`
+		Name         string    `json:"client_name"`
+		RedirectURIs []string  `json:"redirect_uris"`
+		CreatedAt    time.Time `json:"created_at"`
+	}
+
+	ownerID, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, newError(http.StatusUnauthorized, "invalid_token", "Sign in to register a client"))
+		return
+	}
+	params := registration{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeError(w, newError(http.StatusBadRequest, "invalid_client_metadata", "Couldn't decode registration"))
+		return
+	}
+	if params.Name == "" || len(params.Name) > maxClientNameLength {
+		writeError(w, newError(http.StatusBadRequest, "invalid_client_metadata", "client_name must be between 1 and 100 characters"))
+		return
+	}
+	if len(params.RedirectURIs) == 0 {
+		writeError(w, newError(http.StatusBadRequest, "invalid_redirect_uri", "At least one redirect URI is required"))
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if !validRedirectURI(uri) {
+			writeError(w, newError(http.StatusBadRequest, "invalid_redirect_uri", "Redirect URIs must be absolute https URLs without a fragment"))
+			return
+		}
+	}
+
+	client := Client{
+		ID:           uuid.New(),
+		OwnerID:      ownerID,
+		Name:         params.Name,
+		RedirectURIs: params.RedirectURIs,
+		CreatedAt:    s.now().UTC(),
+	}
+	secret := ""
+	if params.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			writeError(w, newError(http.StatusInternalServerError, "server_error", ""))
+			return
+		}
+		client.SecretHash = auth.HashToken(secret)
+	}
+	if err := s.store.CreateClient(r.Context(), client); err != nil {
+		log.Printf("Couldn't save OAuth client: %v", err)
+		writeError(w, newError(http.StatusInternalServerError, "server_error", ""))
+		return
+	}
+	writeJSON(w, http.StatusCreated, response{
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		CreatedAt:    client.CreatedAt,
+	})
+}
+
+// validRedirectURI only allows https, plus plain http on loopback for
+// development and native apps.
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
+
+type authorizeRequest struct {
+	client        Client
+	redirectURI   string
+	scopes        []auth.Scope
+	state         string
+	codeChallenge string
+}
+
+// redirect builds the URL that sends the user back to the client.
+func (ar authorizeRequest) redirect(params url.Values) string {
+	if ar.state != "" {
+		params.Set("state", ar.state)
+	}
+	u, _ := url.Parse(ar.redirectURI)
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// parseAuthorizeRequest validates an authorization request. A bad client or
+// redirect URI must never cause a redirect, since the URI can't be trusted;
+// any other problem is reported back to the client via RedirectTo.
+func (s *Server) parseAuthorizeRequest(r *http.Request) (authorizeRequest, *Error) {
+	values := r.Form
+	ar := authorizeRequest{
+		redirectURI: values.Get("redirect_uri"),
+		state:       values.Get("state"),
+	}
+
+	clientID, err := uuid.Parse(values.Get("client_id"))
+	if err != nil {
+		return ar, newError(http.StatusBadRequest, "invalid_request", "Unknown client_id")
+	}
+	ar.client, err = s.store.GetClient(r.Context(), clientID)
+	if err != nil {
+		return ar, newError(http.StatusBadRequest, "invalid_request", "Unknown client_id")
+	}
+	if !slices.Contains(ar.client.RedirectURIs, ar.redirectURI) {
+		return ar, newError(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for this client")
+	}
+
+	redirectError := func(code, description string) *Error {
+		e := newError(http.StatusBadRequest, code, description)
+		e.RedirectTo = ar.redirect(url.Values{"error": {code}, "error_description": {description}})
+		return e
+	}
+	if values.Get("response_type") != "code" {
+		return ar, redirectError("unsupported_response_type", "Only the code response type is supported")
+	}
+	ar.codeChallenge = values.Get("code_challenge")
+	if ar.codeChallenge == "" || values.Get("code_challenge_method") != "S256" {
+		return ar, redirectError("invalid_request", "PKCE with code_challenge_method S256 is required")
+	}
+	ar.scopes, err = auth.ParseScopes(values.Get("scope"))
+	if err != nil || len(ar.scopes) == 0 {
+		return ar, redirectError("invalid_scope", "Request at least one known scope")
+	}
+	return ar, nil
+}
+
+// authorize describes a pending authorization request so the first-party
+// app can show the signed-in user a consent prompt.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		ClientID   uuid.UUID    `json:"client_id"`
+		ClientName string       `json:"client_name"`
+		Scopes     []auth.Scope `json:"scopes"`
+	}
+
+	if _, err := s.authenticate(r); err != nil {
+		writeError(w, newError(http.StatusUnauthorized, "login_required", "Sign in to continue"))
+		return
+	}
+	r.ParseForm()
+	ar, oauthErr := s.parseAuthorizeRequest(r)
+	if oauthErr != nil {
+		writeError(w, oauthErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, response{
+		ClientID:   ar.client.ID,
+		ClientName: ar.client.Name,
+		Scopes:     ar.scopes,
+	})
+}
+
+// consent records the user's decision and returns where to send them next.
+func (s *Server) consent(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+
+	userID, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, newError(http.StatusUnauthorized, "login_required", "Sign in to continue"))
+		return
+	}
+	r.ParseForm()
+	ar, oauthErr := s.parseAuthorizeRequest(r)
+	if oauthErr != nil {
+		writeError(w, oauthErr)
+		return
+	}
+
+	if r.PostForm.Get("decision") != "approve" {
+		writeJSON(w, http.StatusOK, response{
+			RedirectTo: ar.redirect(url.Values{"error": {"access_denied"}}),
+		})
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		writeError(w, newError(http.StatusInternalServerError, "server_error", ""))
+		return
+	}
+	err = s.store.CreateAuthorizationCode(r.Context(), AuthorizationCode{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      ar.client.ID,
+		UserID:        userID,
+		RedirectURI:   ar.redirectURI,
+		Scope:         auth.FormatScopes(ar.scopes),
+		CodeChallenge: ar.codeChallenge,
+		ExpiresAt:     s.now().UTC().Add(codeTTL),
+	})
+	if err != nil {
+		log.Printf("Couldn't save authorization code: %v", err)
+		writeError(w, newError(http.StatusInternalServerError, "server_error", ""))
+		return
+	}
+	writeJSON(w, http.StatusOK, response{
+		RedirectTo: ar.redirect(url.Values{"code": {code}}),
+	})
+}
+
+// authenticateClient identifies the client calling the token or revocation
+// endpoint, using HTTP Basic auth or client_id/client_secret form fields.
+func (s *Server) authenticateClient(r *http.Request) (Client, *Error) {
+	rawID, secret, ok := r.BasicAuth()
+	if !ok {
+		rawID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	invalid := newError(http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+
+	clientID, err := uuid.Parse(rawID)
+	if err != nil {
+		return Client{}, invalid
+	}
+	client, err := s.store.GetClient(r.Context(), clientID)
+	if err != nil {
+		return Client{}, invalid
+	}
+	if !client.Confidential() {
+		if secret != "" {
+			return Client{}, invalid
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return Client{}, invalid
+	}
+	return client, nil
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, newError(http.StatusBadRequest, "invalid_request", "Couldn't parse form"))
+		return
+	}
+	client, oauthErr := s.authenticateClient(r)
+	if oauthErr != nil {
+		writeError(w, oauthErr)
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		s.exchangeCode(w, r, client)
+	case "refresh_token":
+		s.refresh(w, r, client)
+	default:
+		writeError(w, newError(http.StatusBadRequest, "unsupported_grant_type", ""))
+	}
+}
+
+func (s *Server) exchangeCode(w http.ResponseWriter, r *http.Request, client Client) {
+	invalidGrant := newError(http.StatusBadRequest, "invalid_grant", "Authorization code is invalid or expired")
+
+	code, err := s.store.ConsumeAuthorizationCode(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Couldn't redeem authorization code: %v", err)
+		}
+		writeError(w, invalidGrant)
+		return
+	}
+	if code.ClientID != client.ID ||
+		code.RedirectURI != r.PostForm.Get("redirect_uri") ||
+		!code.ExpiresAt.After(s.now()) ||
+		!verifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		writeError(w, invalidGrant)
+		return
+	}
+
+	scopes, _ := auth.ParseScopes(code.Scope)
+	s.issueTokens(w, r, client.ID, code.UserID, scopes)
+}
+
+func (s *Server) refresh(w http.ResponseWriter, r *http.Request, client Client) {
+	invalidGrant := newError(http.StatusBadRequest, "invalid_grant", "Refresh token is invalid or expired")
+
+	stored, err := s.store.ConsumeRefreshToken(r.Context(), auth.HashToken(r.PostForm.Get("refresh_token")))
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Couldn't redeem refresh token: %v", err)
+		}
+		writeError(w, invalidGrant)
+		return
+	}
+	if stored.ClientID != client.ID || !stored.ExpiresAt.After(s.now()) {
+		writeError(w, invalidGrant)
+		return
+	}
+
+	// A client may ask for fewer scopes than it was granted, never more.
+	scopes, _ := auth.ParseScopes(stored.Scope)
+	if requested := r.PostForm.Get("scope"); requested != "" {
+		narrowed, err := auth.ParseScopes(requested)
+		if err != nil {
+			writeError(w, newError(http.StatusBadRequest, "invalid_scope", err.Error()))
+			return
+		}
+		for _, scope := range narrowed {
+			if !slices.Contains(scopes, scope) {
+				writeError(w, newError(http.StatusBadRequest, "invalid_scope", "Scope exceeds the original grant"))
+				return
+			}
+		}
+		scopes = narrowed
+	}
+	s.issueTokens(w, r, client.ID, stored.UserID, scopes)
+}
+
+func (s *Server) issueTokens(w http.ResponseWriter, r *http.Request, clientID, userID uuid.UUID, scopes []auth.Scope) {
+	type response struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+
+	var version int32
+	if s.tokenVersion != nil {
+		var err error
+		version, err = s.tokenVersion(r.Context(), userID)
+		if err != nil {
+			log.Printf("Couldn't get token version for user %s: %v", userID, err)
+			writeError(w, newError(http.StatusBadRequest, "invalid_grant", "User no longer exists"))
+			return
+		}
+	}
+	accessToken, err := auth.MakeClientJWT(userID, version, clientID, scopes, s.keys, AccessTokenTTL)
+	if err != nil {
+		writeError(w, newError(http.StatusInternalServerError, "server_error", ""))
+		return
+	}
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		writeError(w, newError(http.StatusInternalServerError, "server_error", ""))
+		return
+	}
+	err = s.store.CreateRefreshToken(r.Context(), RefreshToken{
+		TokenHash: auth.HashToken(refreshToken),
+		ClientID:  clientID,
+		UserID:    userID,
+		Scope:     auth.FormatScopes(scopes),
+		ExpiresAt: s.now().UTC().Add(RefreshTokenTTL),
+	})
+	if err != nil {
+		log.Printf("Couldn't save OAuth refresh token: %v", err)
+		writeError(w, newError(http.StatusInternalServerError, "server_error", ""))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        auth.FormatScopes(scopes),
+	})
+}
+
+// revoke implements RFC 7009. Access tokens are short-lived JWTs and can't
+// be revoked individually, so only refresh tokens are affected; as the RFC
+// requires, unknown tokens still get a 200.
+func (s *Server) revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, newError(http.StatusBadRequest, "invalid_request", "Couldn't parse form"))
+		return
+	}
+	client, oauthErr := s.authenticateClient(r)
+	if oauthErr != nil {
+		writeError(w, oauthErr)
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeError(w, newError(http.StatusBadRequest, "invalid_request", "token is required"))
+		return
+	}
+	if err := s.store.RevokeRefreshToken(r.Context(), auth.HashToken(token), client.ID); err != nil {
+		log.Printf("Couldn't revoke OAuth refresh token: %v", err)
+		writeError(w, newError(http.StatusInternalServerError, "server_error", ""))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,125 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Corpus looks passwords up in a local copy of a breached-password list in
+// the Have I Been Pwned format, identified by uppercase SHA-1 hex. It can be
+// either a single file of "HASH:COUNT" lines sorted by hash, which is
+// binary searched, or a directory of range files named after the first five
+// hex digits of the hash and holding "SUFFIX:COUNT" lines.
+type Corpus struct {
+	path string
+	dir  bool
+}
+
+func OpenCorpus(path string) (*Corpus, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Corpus{path: path, dir: info.IsDir()}, nil
+}
+
+// Contains reports whether password appears in the corpus.
+func (c *Corpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if c.dir {
+		return c.containsInRange(hash)
+	}
+	return c.containsInFile(hash)
+}
+
+func (c *Corpus) containsInRange(hash string) (bool, error) {
+	prefix, suffix := hash[:5], hash[5:]
+	f, err := os.Open(filepath.Join(c.path, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(c.path, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.EqualFold(lineHash(scanner.Text()), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func (c *Corpus) containsInFile(hash string) (bool, error) {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	// lo is always the start of a line; lines starting at or after hi are
+	// known to sort after hash.
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start := mid
+		if mid > lo {
+			// Skip the rest of the line mid falls in.
+			_, n, err := readLine(f, mid-1)
+			if err != nil {
+				return false, err
+			}
+			start = mid - 1 + n
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+		line, n, err := readLine(f, start)
+		if err != nil {
+			return false, err
+		}
+		switch cmp := strings.Compare(strings.ToUpper(lineHash(line)), hash); {
+		case cmp == 0:
+			return true, nil
+		case cmp < 0:
+			lo = start + n
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// readLine returns the line starting at off without its line ending, and
+// how many bytes it took up including the ending.
+func readLine(r io.ReaderAt, off int64) (string, int64, error) {
+	reader := bufio.NewReader(io.NewSectionReader(r, off, 1<<20))
+	line, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", 0, fmt.Errorf("reading breached password corpus: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), int64(len(line)), nil
+}
+
+func lineHash(line string) string {
+	hash, _, _ := strings.Cut(line, ":")
+	return strings.TrimSpace(hash)
+}
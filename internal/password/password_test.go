@@ -0,0 +1,141 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		max      int
+		min      int
+	}{
+		{"aaaaaaaaaaaa", 0, 0},
+		{"password", 1, 0},
+		{"P@ssw0rd", 1, 0},
+		{"abcdefgh", 1, 0},
+		{"qwertyuiop", 1, 0},
+		{"12345678", 1, 0},
+		{"dragon12", 1, 0},
+		{"alice2024", 2, 0},
+		{"k7#Qm2vX", 4, 3},
+		{"correct horse battery staple", 4, 4},
+	}
+	for _, tt := range tests {
+		got := Strength(tt.password, "alice@example.com")
+		if got > tt.max || got < tt.min {
+			t.Errorf("Strength(%q) = %d, want between %d and %d", tt.password, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestStrengthUsesUserInputs(t *testing.T) {
+	pw := "wolframite99"
+	if without, with := Strength(pw), Strength(pw, "wolframite@example.com"); with >= without {
+		t.Errorf("Strength(%q) = %d with the email as input, want less than %d", pw, with, without)
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p := DefaultPolicy()
+	p.LoadRejectList(strings.NewReader("# comment\n\nCorrectHorse\n"))
+
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{"", []string{"is required"}},
+		{"a", []string{"must be at least 8 characters long", "is too easy to guess"}},
+		{"password", []string{"is too common"}},
+		{"correcthorse", []string{"is too common"}},
+		{strings.Repeat("k7#Qm2vX", 40), []string{"must be at most 256 bytes long"}},
+		{"k7#Qm2vX-Lp9", nil},
+	}
+	for _, tt := range tests {
+		got, err := p.Check(tt.password)
+		if err != nil {
+			t.Fatalf("Check(%q) error = %v", tt.password, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Check(%q) = %q, want %q", tt.password, got, tt.want)
+		}
+	}
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestCorpusFile(t *testing.T) {
+	var lines []string
+	for i := range 500 {
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(fmt.Sprintf("breached-%d", i)), i+1))
+	}
+	slices.Sort(lines)
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := OpenCorpus(path)
+	if err != nil {
+		t.Fatalf("OpenCorpus() error = %v", err)
+	}
+
+	for _, i := range []int{0, 1, 137, 498, 499} {
+		pw := fmt.Sprintf("breached-%d", i)
+		if ok, err := c.Contains(pw); err != nil || !ok {
+			t.Errorf("Contains(%q) = %v, %v, want true", pw, ok, err)
+		}
+	}
+	for _, pw := range []string{"breached-500", "k7#Qm2vX-Lp9", ""} {
+		if ok, err := c.Contains(pw); err != nil || ok {
+			t.Errorf("Contains(%q) = %v, %v, want false", pw, ok, err)
+		}
+	}
+}
+
+func TestCorpusRangeDirectory(t *testing.T) {
+	dir := t.TempDir()
+	hash := sha1Hex("hunter2")
+	content := "0018A45C4D1DEF81644B54AB7F969B88D65:1\n" + hash[5:] + ":17043\n"
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := OpenCorpus(dir)
+	if err != nil {
+		t.Fatalf("OpenCorpus() error = %v", err)
+	}
+
+	if ok, err := c.Contains("hunter2"); err != nil || !ok {
+		t.Errorf("Contains(hunter2) = %v, %v, want true", ok, err)
+	}
+	if ok, err := c.Contains("k7#Qm2vX-Lp9"); err != nil || ok {
+		t.Errorf("Contains(k7#Qm2vX-Lp9) = %v, %v, want false", ok, err)
+	}
+}
+
+func TestPolicyBreached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(sha1Hex("k7#Qm2vX-Lp9")+":3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := DefaultPolicy()
+	var err error
+	p.Breached, err = OpenCorpus(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := p.Check("k7#Qm2vX-Lp9")
+	if err != nil || !slices.Equal(got, []string{"has appeared in a data breach"}) {
+		t.Errorf("Check() = %q, %v, want breach", got, err)
+	}
+}
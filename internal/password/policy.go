@@ -0,0 +1,94 @@
+// Package password decides whether a password is good enough to accept:
+// long enough, hard enough to guess, not on a rejection list and not known
+// from a data breach.
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Policy is the set of rules passwords must pass. The zero value accepts
+// anything.
+type Policy struct {
+	// MinLength is counted in characters.
+	MinLength int
+	// MaxLength is counted in bytes, since that's what hashing costs.
+	MaxLength int
+	// MinScore is the lowest Strength accepted.
+	MinScore int
+	// Rejected holds lowercased passwords that are refused outright.
+	Rejected map[string]struct{}
+	// Breached, if set, is checked for the password.
+	Breached *Corpus
+}
+
+// DefaultPolicy returns the rules used when nothing is configured.
+func DefaultPolicy() *Policy {
+	p := &Policy{
+		MinLength: 8,
+		// Long enough for any passphrase, short enough that hashing it
+		// isn't a denial of service.
+		MaxLength: 256,
+		MinScore:  2,
+		Rejected:  map[string]struct{}{},
+	}
+	for _, pw := range commonPasswords {
+		p.Rejected[pw] = struct{}{}
+	}
+	return p
+}
+
+// LoadRejectList adds the passwords in r, one per line, to the rejection
+// list. Blank lines and lines starting with # are skipped.
+func (p *Policy) LoadRejectList(r io.Reader) error {
+	if p.Rejected == nil {
+		p.Rejected = map[string]struct{}{}
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.Rejected[strings.ToLower(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// Check returns every rule password breaks, worded for the user. userInputs
+// are strings the password shouldn't be based on, like the email address.
+// An error means the breached-password corpus couldn't be read; the other
+// rules have still been checked.
+func (p *Policy) Check(password string, userInputs ...string) ([]string, error) {
+	if password == "" {
+		return []string{"is required"}, nil
+	}
+
+	var problems []string
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes long", p.MaxLength))
+	}
+	if _, ok := p.Rejected[strings.ToLower(password)]; ok {
+		problems = append(problems, "is too common")
+	} else if Strength(password, userInputs...) < p.MinScore {
+		problems = append(problems, "is too easy to guess")
+	}
+	if p.Breached == nil {
+		return problems, nil
+	}
+	breached, err := p.Breached.Contains(password)
+	if err != nil {
+		return problems, err
+	}
+	if breached {
+		problems = append(problems, "has appeared in a data breach")
+	}
+	return problems, nil
+}
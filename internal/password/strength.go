@@ -0,0 +1,144 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords are words and passwords attackers try first. They are
+// matched after lowercasing and undoing common letter substitutions.
+var commonPasswords = []string{
+	"password", "qwerty", "letmein", "dragon", "monkey", "football",
+	"baseball", "iloveyou", "admin", "welcome", "login", "master", "hello",
+	"shadow", "sunshine", "princess", "superman", "batman", "trustno1",
+	"starwars", "whatever", "freedom", "secret", "abc123", "chirpy", "chirp",
+	"michael", "jennifer", "jordan", "hunter", "ranger", "buster", "soccer",
+	"hockey", "killer", "george", "charlie", "andrew", "thomas", "summer",
+	"winter", "spring", "autumn", "flower", "cookie", "pepper", "ginger",
+	"orange", "banana", "computer", "internet", "samsung", "google",
+	"access", "mustang", "maggie", "daniel", "pokemon", "matrix", "ninja",
+	"tigger", "purple", "silver", "golden", "lovely", "family", "cheese",
+	"blink182", "zaq1zaq1", "passwd", "changeme", "default", "guest",
+}
+
+// keyboardRows are scanned for runs of neighbouring keys like "asdf".
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+var leet = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t",
+	"@", "a", "$", "s", "!", "i",
+)
+
+// Strength estimates how hard password is to guess on the 0-4 scale used by
+// zxcvbn: 0 falls to a handful of guesses, 4 needs more than 10^10.
+// userInputs are strings an attacker would try first, like the email
+// address.
+func Strength(password string, userInputs ...string) int {
+	words := make([]string, 0, len(commonPasswords)+len(userInputs))
+	words = append(words, commonPasswords...)
+	for _, input := range userInputs {
+		input = strings.ToLower(input)
+		if local, _, ok := strings.Cut(input, "@"); ok {
+			words = append(words, local)
+		}
+		words = append(words, input)
+	}
+	return score(log10Guesses(password, words))
+}
+
+func score(log10Guesses float64) int {
+	switch {
+	case log10Guesses < 3:
+		return 0
+	case log10Guesses < 6:
+		return 1
+	case log10Guesses < 8:
+		return 2
+	case log10Guesses < 10:
+		return 3
+	}
+	return 4
+}
+
+// log10Guesses walks the password left to right. Stretches matching a
+// dictionary word cost as many guesses as the dictionary has words;
+// repeats, sequences and keyboard runs are nearly free; anything else is
+// brute forced at ten guesses per character, as zxcvbn assumes.
+func log10Guesses(password string, words []string) float64 {
+	runes := []rune(password)
+	normalized := []rune(leet.Replace(strings.ToLower(password)))
+	if len(normalized) != len(runes) {
+		// Case mapping changed the length; give up on dictionary matching
+		// rather than misalign the two.
+		normalized = runes
+	}
+	dictionaryCost := math.Log10(float64(len(words)))
+
+	total := 0.0
+	for i := 0; i < len(runes); {
+		if n := longestWord(normalized[i:], words); n > 0 {
+			total += dictionaryCost + variationCost(runes[i:i+n])
+			i += n
+			continue
+		}
+		switch {
+		case i > 0 && runes[i] == runes[i-1]:
+			total += 0.1
+		case i > 0 && isSequence(runes, i):
+			total += 0.3
+		case i > 0 && isKeyboardNeighbour(runes[i-1], runes[i]):
+			total += 0.5
+		default:
+			total += 1
+		}
+		i++
+	}
+	return total
+}
+
+// longestWord returns the length of the longest word s starts with, or 0.
+func longestWord(s []rune, words []string) int {
+	best := 0
+	for _, w := range words {
+		n := len([]rune(w))
+		if n < 4 || n > len(s) || n <= best {
+			continue
+		}
+		if string(s[:n]) == w {
+			best = n
+		}
+	}
+	return best
+}
+
+// variationCost charges for capitals and substitutions in a dictionary
+// match, which attackers try but only after the plain word.
+func variationCost(match []rune) float64 {
+	cost := 0.0
+	for _, r := range match {
+		if unicode.IsUpper(r) || !unicode.IsLetter(r) {
+			cost += 0.3
+		}
+	}
+	return cost
+}
+
+// isSequence reports whether runes[i] follows on from the rune before it,
+// as in "abc" or "987".
+func isSequence(runes []rune, i int) bool {
+	d := runes[i] - runes[i-1]
+	return d == 1 || d == -1
+}
+
+func isKeyboardNeighbour(a, b rune) bool {
+	a, b = unicode.ToLower(a), unicode.ToLower(b)
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, a)
+		j := strings.IndexRune(row, b)
+		if i >= 0 && j >= 0 && (i-j == 1 || j-i == 1) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+// Package ratelimit implements token-bucket rate limiting on top of a
+// pluggable Store, so the same policies can be enforced by a single process
+// (MemoryStore) or shared across replicas by a database-backed store.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Policy describes a token bucket: up to Limit requests may be made in a
+// burst, and the bucket refills completely over Period.
+type Policy struct {
+	// Name namespaces bucket keys so that routes do not share buckets.
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// rate returns the refill rate in tokens per second.
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// String formats the policy the way the RateLimit-Policy header expects.
+func (p Policy) String() string {
+	return fmt.Sprintf("%d;w=%d", p.Limit, int(math.Ceil(p.Period.Seconds())))
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long to wait until a token is available again. It
+	// is zero when the request was allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// Store takes tokens from buckets identified by key.
+type Store interface {
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	period time.Duration
+}
+
+// MemoryStore keeps buckets in process memory. It is safe for concurrent use
+// but is not shared between replicas.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	if policy.Limit <= 0 || policy.Period <= 0 {
+		return Result{}, fmt.Errorf("invalid rate limit policy %q", policy.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Limit), last: now}
+		s.buckets[key] = b
+	}
+	b.period = policy.Period
+	return take(b, policy, now), nil
+}
+
+// take refills b for the time elapsed since it was last used and then tries
+// to remove a single token from it.
+func take(b *bucket, policy Policy, now time.Time) Result {
+	rate := policy.rate()
+	limit := float64(policy.Limit)
+
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(limit, b.tokens+elapsed*rate)
+		b.last = now
+	}
+
+	res := Result{Limit: policy.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(math.Floor(b.tokens))
+	res.ResetAfter = seconds((limit - b.tokens) / rate)
+	return res
+}
+
+// sweep drops buckets that have been idle long enough to refill completely,
+// since they are indistinguishable from a fresh bucket.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.last) >= b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestStore() (*MemoryStore, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	return store, &now
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	store, now := newTestStore()
+	policy := Policy{Name: "test", Limit: 3, Period: 3 * time.Second}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		res, err := store.Take(ctx, "k", policy)
+		if err != nil {
+			t.Fatalf("Take() error = %v", err)
+		}
+		if !res.Allowed {
+			t.Fatalf("request %d was denied, want allowed", i)
+		}
+		if res.Remaining != 2-i {
+			t.Errorf("request %d Remaining = %d, want %d", i, res.Remaining, 2-i)
+		}
+	}
+
+	res, _ := store.Take(ctx, "k", policy)
+	if res.Allowed {
+		t.Fatal("request over the limit was allowed")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("RetryAfter = %v, want %v", res.RetryAfter, time.Second)
+	}
+	if res.ResetAfter != 3*time.Second {
+		t.Errorf("ResetAfter = %v, want %v", res.ResetAfter, 3*time.Second)
+	}
+
+	*now = now.Add(time.Second)
+	res, _ = store.Take(ctx, "k", policy)
+	if !res.Allowed {
+		t.Error("request after refill was denied")
+	}
+}
+
+func TestMemoryStoreKeysAreIndependent(t *testing.T) {
+	store, _ := newTestStore()
+	policy := Policy{Name: "test", Limit: 1, Period: time.Minute}
+	ctx := context.Background()
+
+	if res, _ := store.Take(ctx, "a", policy); !res.Allowed {
+		t.Fatal("first request for a was denied")
+	}
+	if res, _ := store.Take(ctx, "a", policy); res.Allowed {
+		t.Fatal("second request for a was allowed")
+	}
+	if res, _ := store.Take(ctx, "b", policy); !res.Allowed {
+		t.Fatal("first request for b was denied")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store, now := newTestStore()
+	policy := Policy{Name: "test", Limit: 1, Period: time.Second}
+	ctx := context.Background()
+
+	store.Take(ctx, "a", policy)
+	*now = now.Add(2 * sweepInterval)
+	store.Take(ctx, "b", policy)
+
+	if _, ok := store.buckets["a"]; ok {
+		t.Error("idle bucket was not swept")
+	}
+	if _, ok := store.buckets["b"]; !ok {
+		t.Error("active bucket was swept")
+	}
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	store, _ := newTestStore()
+	if _, err := store.Take(context.Background(), "k", Policy{Name: "bad"}); err == nil {
+		t.Error("Take() with zero policy should fail")
+	}
+}
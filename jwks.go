@@ -0,0 +1,32 @@
+package main
+
+/*Stuff related to JWT signing keys*/
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+)
+
+// loadKeyRing reads the signing keys from JWT_KEYS_DIR. Without one, a
+// throwaway key is generated, which is fine for development but means tokens
+// don't survive restarts and can't be verified by other replicas.
+func loadKeyRing() (*auth.KeyRing, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		log.Println("JWT_KEYS_DIR not set, signing tokens with an ephemeral key")
+		key, err := auth.GenerateEd25519Key("ephemeral")
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewKeyRing(key), nil
+	}
+	return auth.LoadKeyRing(dir, os.Getenv("JWT_SIGNING_KEY_ID"))
+}
+
+func (cfg *apiConfig) jwks(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.keys.JWKS())
+}
@@ -0,0 +1,142 @@
+package main
+
+/*Brute-force protection for login*/
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"example.com/username/bootdev-chirpy/internal/database"
+	"example.com/username/bootdev-chirpy/internal/mailer"
+	"example.com/username/bootdev-chirpy/internal/ratelimit"
+)
+
+const (
+	// maxFailedLogins is the number of consecutive failures after which an
+	// account is locked for lockoutDuration.
+	maxFailedLogins = 5
+	lockoutDuration = 15 * time.Minute
+
+	// Failures below freeLoginFailures are not delayed so typos stay cheap;
+	// after that each failure doubles the delay up to maxLoginDelay.
+	freeLoginFailures = 2
+	maxLoginDelay     = 10 * time.Second
+)
+
+// ipLoginFailures counts failed logins per client IP regardless of which
+// account was targeted, which catches password spraying.
+var ipLoginFailures = ratelimit.Policy{Name: "login-failures", Limit: 20, Period: time.Hour}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// checkDummyPassword spends as long as a real password check so that unknown
+// emails can't be told apart from wrong passwords by timing.
+func checkDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = auth.HashPassword("chirpy-dummy-password")
+	})
+	auth.CheckPasswordHash(dummyHash, password)
+}
+
+// errAccountLocked is returned by checkCurrentPassword while the account is
+// locked.
+var errAccountLocked = errors.New("account is locked")
+
+// checkCurrentPassword re-authenticates a signed-in user before a sensitive
+// change. Wrong passwords count towards the lockout like failed logins, so a
+// stolen access token can't be used to guess the password.
+func (cfg *apiConfig) checkCurrentPassword(req *http.Request, user database.User, password string) error {
+	if isLocked(user) {
+		return errAccountLocked
+	}
+	err := auth.CheckPasswordHash(user.Password, password)
+	if err != nil {
+		cfg.loginFailed(req, &user)
+		return err
+	}
+	return nil
+}
+
+func isLocked(user database.User) bool {
+	return user.LockedUntil.Valid && user.LockedUntil.Time.After(time.Now().UTC())
+}
+
+// loginFailed records a failed attempt against the client IP and, if known,
+// the account, and then stalls the response progressively.
+func (cfg *apiConfig) loginFailed(req *http.Request, user *database.User) {
+	ctx := req.Context()
+	failures := 0
+
+	res, err := cfg.limiter.Take(ctx, ipLoginFailures.Name+":"+cfg.clientIP(req), ipLoginFailures)
+	if err != nil {
+		log.Printf("Couldn't record login failure for IP: %v", err)
+	} else {
+		failures = res.Limit - res.Remaining
+	}
+
+	if user != nil && !isLocked(*user) {
+		attempts, err := cfg.db.RecordFailedLogin(ctx, user.ID)
+		if err != nil {
+			log.Printf("Couldn't record login failure for user %s: %v", user.ID, err)
+		} else {
+			failures = max(failures, int(attempts))
+			if attempts >= maxFailedLogins {
+				cfg.lockAccount(ctx, *user)
+			}
+		}
+	}
+
+	delay := loginDelay(failures)
+	if delay == 0 {
+		return
+	}
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+}
+
+func loginDelay(failures int) time.Duration {
+	if failures <= freeLoginFailures {
+		return 0
+	}
+	delay := time.Second << (failures - freeLoginFailures - 1)
+	if delay > maxLoginDelay || delay <= 0 {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+func (cfg *apiConfig) lockAccount(ctx context.Context, user database.User) {
+	until := time.Now().UTC().Add(lockoutDuration)
+	err := cfg.db.LockUser(ctx, database.LockUserParams{
+		ID:          user.ID,
+		LockedUntil: sql.NullTime{Time: until, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Couldn't lock user %s: %v", user.ID, err)
+		return
+	}
+	cfg.notifyLockout(ctx, user, until)
+}
+
+func (cfg *apiConfig) notifyLockout(ctx context.Context, user database.User, until time.Time) {
+	log.Printf("Account %s locked until %s after %d failed logins", user.Email, until.Format(time.RFC3339), maxFailedLogins)
+	cfg.sendMail(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy account has been locked",
+		Body: fmt.Sprintf("There were %d failed attempts to log in to your account, so it is locked until %s.\n\n"+
+			"If this wasn't you, consider changing your password once you can log in again.\n",
+			maxFailedLogins, until.Format(time.RFC1123)),
+	})
+}
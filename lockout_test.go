@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/database"
+)
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{-1, 0},
+		{0, 0},
+		{freeLoginFailures, 0},
+		{freeLoginFailures + 1, time.Second},
+		{freeLoginFailures + 2, 2 * time.Second},
+		{freeLoginFailures + 3, 4 * time.Second},
+		{freeLoginFailures + 4, 8 * time.Second},
+		{freeLoginFailures + 5, maxLoginDelay},
+		// Shifting this far overflows; it must still clamp.
+		{freeLoginFailures + 64, maxLoginDelay},
+		{1000, maxLoginDelay},
+	}
+	for _, tt := range tests {
+		if got := loginDelay(tt.failures); got != tt.want {
+			t.Errorf("loginDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestIsLocked(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name        string
+		lockedUntil sql.NullTime
+		want        bool
+	}{
+		{"Never locked", sql.NullTime{}, false},
+		{"Locked", sql.NullTime{Time: now.Add(lockoutDuration), Valid: true}, true},
+		{"Lock expired", sql.NullTime{Time: now.Add(-time.Second), Valid: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := database.User{LockedUntil: tt.lockedUntil}
+			if got := isLocked(user); got != tt.want {
+				t.Errorf("isLocked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
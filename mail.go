@@ -0,0 +1,44 @@
+package main
+
+/*Stuff related to sending email*/
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/mailer"
+)
+
+const sendMailTimeout = 30 * time.Second
+
+// loadMailer sends through SMTP_ADDR when it is set. Otherwise mail is
+// written to stdout, which is enough to follow links during development.
+func loadMailer() (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@localhost>"
+	}
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		log.Println("SMTP_ADDR not set, writing outgoing mail to stdout")
+		return mailer.NewWriterMailer(os.Stdout, from), nil
+	}
+	return mailer.NewSMTPMailer(addr, from, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+}
+
+// sendMail delivers msg in the background. Handlers shouldn't wait on the
+// mail server, and answering at the same speed whether or not mail was sent
+// keeps response times from revealing which addresses have accounts.
+func (cfg *apiConfig) sendMail(ctx context.Context, msg mailer.Message) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, sendMailTimeout)
+		defer cancel()
+		err := cfg.mailer.Send(ctx, msg)
+		if err != nil {
+			log.Printf("Couldn't send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
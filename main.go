@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"sync/atomic"
 
 	"example.com/username/bootdev-chirpy/internal/database"
+	"example.com/username/bootdev-chirpy/internal/oauth"
+	"example.com/username/bootdev-chirpy/internal/ratelimit"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -20,7 +25,59 @@ func main() {
 	dbQueries := database.New(db)
 	fmt.Println(dbQueries)
 
+	keys, err := loadKeyRing()
+	if err != nil {
+		log.Fatalf("Couldn't load JWT signing keys: %v", err)
+	}
+
+	mail, err := loadMailer()
+	if err != nil {
+		log.Fatalf("Couldn't set up mailer: %v", err)
+	}
+	verification, err := parseVerificationPolicy(os.Getenv("EMAIL_VERIFICATION"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = loadArgon2Params()
+	if err != nil {
+		log.Fatalf("Couldn't configure password hashing: %v", err)
+	}
+	passwords, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Couldn't load password policy: %v", err)
+	}
+
+	deletionGrace, err := loadDeletionGrace()
+	if err != nil {
+		log.Fatal(err)
+	}
+	plans, err := loadEntitlements()
+	if err != nil {
+		log.Fatalf("Couldn't load entitlements: %v", err)
+	}
+	providers, err := loadBillingProviders(plans)
+	if err != nil {
+		log.Fatal(err)
+	}
+	trustedProxies, err := loadTrustedProxies()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	secret := os.Getenv("SECRET")
+	if secret == "" {
+		// Signed links then stop working on restart, like tokens do without
+		// JWT_KEYS_DIR.
+		log.Println("SECRET not set, signing links with an ephemeral secret")
+		secret = rand.Text()
+	}
+
 	const port = "8080"
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
+	}
 
 	mux := http.NewServeMux()
 
@@ -32,33 +89,83 @@ func main() {
 	apiCnfg := apiConfig{
 		fileserverHits: atomic.Int32{},
 		db:             dbQueries,
+		conn:           db,
 		platform:       os.Getenv("PLATFORM"),
-		secret:         os.Getenv("SECRET"),
-		polkaKey:       os.Getenv("POLKA_KEY"),
+		secret:         secret,
+		keys:           keys,
+		billing:        providers,
+		adminKey:       os.Getenv("ADMIN_KEY"),
+		limiter:        ratelimit.NewMemoryStore(),
+		trustedProxies: trustedProxies,
+		mailer:         mail,
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		verification:   verification,
+		passwords:      passwords,
+		deletionGrace:  deletionGrace,
+		entitlements:   plans,
 	}
 
 	log.Printf("Serving on port: %s\n", port)
 	/*Admin stuuf */
 	mux.HandleFunc("GET /admin/metrics", apiCnfg.metrics)
 	mux.HandleFunc("POST /admin/reset", apiCnfg.reset)
+	mux.HandleFunc("POST /admin/users/{userID}/unlock", apiCnfg.unlockUser)
+	mux.HandleFunc("POST /admin/users/{userID}/ban", apiCnfg.banUser)
+	mux.HandleFunc("DELETE /admin/users/{userID}/ban", apiCnfg.unbanUser)
+	mux.HandleFunc("GET /admin/webhooks", apiCnfg.listWebhookEvents)
+	mux.HandleFunc("POST /admin/webhooks/{eventID}/replay", apiCnfg.replayWebhookEvent)
 
 	/* API stuff */
 	mux.HandleFunc("GET /api/healthz", healthCheck)
 	/*mux.HandleFunc("POST /api/validate_chirp", validateChirp)*/
 	mux.HandleFunc("POST /api/users", apiCnfg.createUser)
-	mux.HandleFunc("PUT /api/users", apiCnfg.updateUser)
+	// These check the account password again, so they are limited like login.
+	mux.Handle("PUT /api/users", apiCnfg.middlewareRateLimit(loginRateLimit, http.HandlerFunc(apiCnfg.updateUser)))
+	mux.Handle("PATCH /api/users/me", apiCnfg.middlewareRateLimit(loginRateLimit, http.HandlerFunc(apiCnfg.patchUser)))
+	mux.Handle("DELETE /api/users/me", apiCnfg.middlewareRateLimit(loginRateLimit, http.HandlerFunc(apiCnfg.deleteMe)))
+	mux.Handle("POST /api/users/me/export", apiCnfg.middlewareRateLimit(exportRateLimit, http.HandlerFunc(apiCnfg.requestExport)))
+	mux.HandleFunc("GET /api/users/me/export/{exportID}", apiCnfg.getExport)
+	mux.HandleFunc("GET /api/users/me/subscription", apiCnfg.getSubscription)
+	mux.HandleFunc("GET /api/exports/{exportID}/download", apiCnfg.downloadExport)
+	mux.Handle("POST /api/users/me/import", apiCnfg.middlewareRateLimit(importRateLimit, http.HandlerFunc(apiCnfg.importChirps)))
+	mux.HandleFunc("GET /api/users/{handle}", apiCnfg.getProfile)
+	mux.HandleFunc("GET /api/users/{handle}/chirps", apiCnfg.getProfileChirps)
+	mux.Handle("POST /api/users/me/2fa", apiCnfg.middlewareRateLimit(loginRateLimit, http.HandlerFunc(apiCnfg.enrollTwoFactor)))
+	mux.Handle("POST /api/users/me/2fa/confirm", apiCnfg.middlewareRateLimit(loginRateLimit, http.HandlerFunc(apiCnfg.confirmTwoFactor)))
+	mux.Handle("DELETE /api/users/me/2fa", apiCnfg.middlewareRateLimit(loginRateLimit, http.HandlerFunc(apiCnfg.disableTwoFactor)))
+	mux.HandleFunc("GET /api/users/verify", apiCnfg.verifyEmail)
+	mux.Handle("POST /api/users/verification", apiCnfg.middlewareRateLimit(verificationRateLimit, http.HandlerFunc(apiCnfg.resendVerification)))
 
-	mux.HandleFunc("POST /api/chirps", apiCnfg.createChirp)
+	mux.Handle("POST /api/chirps", apiCnfg.middlewareRateLimit(chirpRateLimit, http.HandlerFunc(apiCnfg.createChirp)))
 	mux.HandleFunc("GET /api/chirps", apiCnfg.getChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCnfg.getChirp)
+	mux.Handle("PUT /api/chirps/{chirpID}", apiCnfg.middlewareRateLimit(chirpRateLimit, http.HandlerFunc(apiCnfg.editChirp)))
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCnfg.deleteChirp)
 
-	mux.HandleFunc("POST /api/login", apiCnfg.login)
+	mux.Handle("POST /api/login", apiCnfg.middlewareRateLimit(loginRateLimit, http.HandlerFunc(apiCnfg.login)))
+	mux.Handle("POST /api/login/2fa", apiCnfg.middlewareRateLimit(loginRateLimit, http.HandlerFunc(apiCnfg.loginTwoFactor)))
+	mux.Handle("POST /api/password/forgot", apiCnfg.middlewareRateLimit(passwordResetRateLimit, http.HandlerFunc(apiCnfg.forgotPassword)))
+	mux.Handle("POST /api/password/reset", apiCnfg.middlewareRateLimit(passwordResetRateLimit, http.HandlerFunc(apiCnfg.resetPassword)))
 	mux.HandleFunc("POST /api/refresh", apiCnfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", apiCnfg.handlerRevoke)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCnfg.upgradeUser)
+	mux.HandleFunc("POST /api/tokens", apiCnfg.createAPIToken)
+	mux.HandleFunc("GET /api/tokens", apiCnfg.getAPITokens)
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", apiCnfg.deleteAPIToken)
+	mux.HandleFunc("GET /api/sessions", apiCnfg.getSessions)
+	mux.HandleFunc("DELETE /api/sessions", apiCnfg.deleteAllSessions)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCnfg.deleteSession)
+	for name, provider := range providers {
+		mux.HandleFunc("POST /api/"+name+"/webhooks", apiCnfg.billingWebhook(provider))
+	}
+
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCnfg.jwks)
+
+	/* OAuth stuff */
+	oauthServer := oauth.NewServer(oauthStore{db: dbQueries}, keys, apiCnfg.authenticate, apiCnfg.oauthTokenVersion)
+	mux.Handle("/oauth/", oauthServer)
 
 	/* App stuff */
 	mux.Handle("/app/", http.StripPrefix("/app", apiCnfg.middlewareMetricsInc(http.FileServer(http.Dir(".")))))
+	go apiCnfg.runPurges(context.Background())
 	log.Fatal(srv.ListenAndServe())
 }
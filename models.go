@@ -1,10 +1,17 @@
 package main
 
 import (
+	"database/sql"
 	"sync/atomic"
 	"time"
 
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"example.com/username/bootdev-chirpy/internal/billing"
 	"example.com/username/bootdev-chirpy/internal/database"
+	"example.com/username/bootdev-chirpy/internal/entitlements"
+	"example.com/username/bootdev-chirpy/internal/mailer"
+	"example.com/username/bootdev-chirpy/internal/password"
+	"example.com/username/bootdev-chirpy/internal/ratelimit"
 	"github.com/google/uuid"
 )
 
@@ -26,10 +33,55 @@ type Chirp struct {
 	UserID    uuid.UUID `json:"user_id"`
 }
 
+// Profile is what anyone can see about a user. It must never include the
+// email address.
+type Profile struct {
+	ID            uuid.UUID  `json:"id"`
+	Handle        string     `json:"handle"`
+	DisplayName   string     `json:"display_name"`
+	Bio           string     `json:"bio"`
+	AvatarMediaID *uuid.UUID `json:"avatar_media_id"`
+	Location      string     `json:"location"`
+	Website       string     `json:"website"`
+	CreatedAt     time.Time  `json:"created_at"`
+	IsChirpyRed   bool       `json:"is_chirpy_red"`
+}
+
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type APIToken struct {
+	ID         uuid.UUID    `json:"id"`
+	Name       string       `json:"name"`
+	Scopes     []auth.Scope `json:"scopes"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  *time.Time   `json:"expires_at"`
+	LastUsedAt *time.Time   `json:"last_used_at"`
+	// Token is only filled in once, when the token is created.
+	Token string `json:"token,omitempty"`
+}
+
+// DataExport is the status of an archive of a user's data.
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
 type parameters struct {
 	Body             string        `json:"body"`
 	Email            string        `json:"email"`
 	Password         string        `json:"password"`
+	Handle           string        `json:"handle"`
 	UserId           uuid.NullUUID `json:"user_id"`
 	ExpiresInSeconds int           `json:"expires_in_seconds"`
 }
@@ -37,7 +89,18 @@ type parameters struct {
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db             *database.Queries
+	conn           *sql.DB
 	platform       string
 	secret         string
-	polkaKey       string
+	keys           *auth.KeyRing
+	billing        map[string]billing.Provider
+	adminKey       string
+	limiter        ratelimit.Store
+	trustedProxies int
+	mailer         mailer.Mailer
+	baseURL        string
+	verification   verificationPolicy
+	passwords      *password.Policy
+	deletionGrace  time.Duration
+	entitlements   entitlements.Table
 }
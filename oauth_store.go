@@ -0,0 +1,127 @@
+package main
+
+/*Postgres storage for the OAuth server*/
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"example.com/username/bootdev-chirpy/internal/database"
+	"example.com/username/bootdev-chirpy/internal/oauth"
+	"github.com/google/uuid"
+)
+
+type oauthStore struct {
+	db *database.Queries
+}
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return oauth.ErrNotFound
+	}
+	return err
+}
+
+func (s oauthStore) CreateClient(ctx context.Context, client oauth.Client) error {
+	return s.db.CreateOAuthClient(ctx, database.CreateOAuthClientParams{
+		ID:           client.ID,
+		CreatedAt:    client.CreatedAt,
+		OwnerID:      client.OwnerID,
+		Name:         client.Name,
+		SecretHash:   client.SecretHash,
+		RedirectUris: strings.Join(client.RedirectURIs, " "),
+	})
+}
+
+func (s oauthStore) GetClient(ctx context.Context, id uuid.UUID) (oauth.Client, error) {
+	client, err := s.db.GetOAuthClient(ctx, id)
+	if err != nil {
+		return oauth.Client{}, notFound(err)
+	}
+	return oauth.Client{
+		ID:           client.ID,
+		OwnerID:      client.OwnerID,
+		Name:         client.Name,
+		SecretHash:   client.SecretHash,
+		RedirectURIs: strings.Fields(client.RedirectUris),
+		CreatedAt:    client.CreatedAt,
+	}, nil
+}
+
+func (s oauthStore) CreateAuthorizationCode(ctx context.Context, code oauth.AuthorizationCode) error {
+	return s.db.CreateOAuthAuthorizationCode(ctx, database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      code.CodeHash,
+		ClientID:      code.ClientID,
+		UserID:        code.UserID,
+		RedirectUri:   code.RedirectURI,
+		Scope:         code.Scope,
+		CodeChallenge: code.CodeChallenge,
+		ExpiresAt:     code.ExpiresAt,
+	})
+}
+
+func (s oauthStore) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (oauth.AuthorizationCode, error) {
+	code, err := s.db.ConsumeOAuthAuthorizationCode(ctx, codeHash)
+	if err != nil {
+		return oauth.AuthorizationCode{}, notFound(err)
+	}
+	return oauth.AuthorizationCode{
+		CodeHash:      code.CodeHash,
+		ClientID:      code.ClientID,
+		UserID:        code.UserID,
+		RedirectURI:   code.RedirectUri,
+		Scope:         code.Scope,
+		CodeChallenge: code.CodeChallenge,
+		ExpiresAt:     code.ExpiresAt,
+	}, nil
+}
+
+func (s oauthStore) CreateRefreshToken(ctx context.Context, token oauth.RefreshToken) error {
+	return s.db.CreateOAuthRefreshToken(ctx, database.CreateOAuthRefreshTokenParams{
+		TokenHash: token.TokenHash,
+		ClientID:  token.ClientID,
+		UserID:    token.UserID,
+		Scope:     token.Scope,
+		ExpiresAt: token.ExpiresAt,
+	})
+}
+
+func (s oauthStore) ConsumeRefreshToken(ctx context.Context, tokenHash string) (oauth.RefreshToken, error) {
+	token, err := s.db.ConsumeOAuthRefreshToken(ctx, tokenHash)
+	if err != nil {
+		return oauth.RefreshToken{}, notFound(err)
+	}
+	return oauth.RefreshToken{
+		TokenHash: token.TokenHash,
+		ClientID:  token.ClientID,
+		UserID:    token.UserID,
+		Scope:     token.Scope,
+		ExpiresAt: token.ExpiresAt,
+	}, nil
+}
+
+func (s oauthStore) RevokeRefreshToken(ctx context.Context, tokenHash string, clientID uuid.UUID) error {
+	return s.db.RevokeOAuthRefreshToken(ctx, database.RevokeOAuthRefreshTokenParams{
+		TokenHash: tokenHash,
+		ClientID:  clientID,
+	})
+}
+
+// oauthTokenVersion refuses to hand banned or deactivated users' data to
+// clients; both bump the token version, but a client could otherwise just
+// refresh.
+func (cfg *apiConfig) oauthTokenVersion(ctx context.Context, userID uuid.UUID) (int32, error) {
+	user, err := cfg.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if user.BannedAt.Valid {
+		return 0, errors.New("user is banned")
+	}
+	if user.DeactivatedAt.Valid {
+		return 0, errors.New("user is deactivated")
+	}
+	return user.TokenVersion, nil
+}
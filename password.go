@@ -0,0 +1,153 @@
+package main
+
+/*Stuff related to resetting forgotten passwords*/
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"example.com/username/bootdev-chirpy/internal/database"
+	"example.com/username/bootdev-chirpy/internal/mailer"
+)
+
+const passwordResetExpiresIn = time.Hour
+
+// forgotPassword mails a reset token to the address if it has an account.
+// The response is the same either way, so it can't be used to find out who
+// has signed up.
+func (cfg *apiConfig) forgotPassword(w http.ResponseWriter, req *http.Request) {
+	params := parameters{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByMail(req.Context(), params.Email)
+	if err == nil && !user.BannedAt.Valid {
+		err = cfg.sendPasswordReset(req, user)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't send reset email", err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) sendPasswordReset(req *http.Request, user database.User) error {
+	// Reset tokens are random strings stored as digests, just like refresh
+	// tokens.
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	err = cfg.db.CreatePasswordReset(req.Context(), database.CreatePasswordResetParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetExpiresIn),
+	})
+	if err != nil {
+		return err
+	}
+	cfg.sendMail(req.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: "Someone asked to reset the password for your Chirpy account. Use this token to choose a new one:\n\n" +
+			token + "\n\nIt can be used once and expires in an hour. If you didn't ask for this, you can ignore this email.\n",
+	})
+	return nil
+}
+
+// resetPassword sets a new password using a token from forgotPassword. Every
+// session is ended, since whoever forgot the password may not be the only
+// one who had it.
+func (cfg *apiConfig) resetPassword(w http.ResponseWriter, req *http.Request) {
+	type resetParameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	params := resetParameters{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters", err)
+		return
+	}
+	// The token is only spent if everything else goes through too, including
+	// the password check, which needs the account's email.
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start reset", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	userID, err := qtx.ConsumePasswordReset(req.Context(), database.ConsumePasswordResetParams{
+		TokenHash: auth.HashToken(params.Token),
+		ExpiresAt: time.Now().UTC(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check reset token", err)
+		return
+	}
+	user, err := qtx.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	errs := fieldErrors{}
+	cfg.checkPassword(errs, "password", params.Password, user.Email)
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+	hash, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+	err = qtx.ResetPassword(req.Context(), database.ResetPasswordParams{
+		ID:       userID,
+		Password: hash,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+	err = qtx.RevokeAllSessionsForUser(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	err = qtx.RevokeOAuthRefreshTokensForUser(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke app access", err)
+		return
+	}
+	// Whoever had the account may have minted personal access tokens.
+	err = qtx.RevokeAPITokensForUser(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke API tokens", err)
+		return
+	}
+	err = qtx.DeletePasswordResetsForUser(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete reset tokens", err)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
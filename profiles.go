@@ -0,0 +1,133 @@
+package main
+
+/*Stuff related to public user profiles*/
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"example.com/username/bootdev-chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxLocationLength    = 30
+	maxWebsiteLength     = 100
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// reservedHandles would be shadowed by other routes under /api/users/.
+var reservedHandles = []string{"me", "verify", "verification", "admin"}
+
+func validateHandle(errs fieldErrors, field, handle string) {
+	if !handlePattern.MatchString(handle) {
+		errs.add(field, "must be 3 to 30 letters, digits or underscores")
+		return
+	}
+	if slices.Contains(reservedHandles, strings.ToLower(handle)) {
+		errs.add(field, "is reserved")
+	}
+}
+
+// generateHandle picks a placeholder handle for accounts created without
+// one. Users can change it later.
+func generateHandle() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "user_" + hex.EncodeToString(b), nil
+}
+
+func validateMaxLength(errs fieldErrors, field, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		errs.add(field, fmt.Sprintf("must be at most %d characters long", max))
+	}
+}
+
+func validateWebsite(errs fieldErrors, field, website string) {
+	if website == "" {
+		return
+	}
+	validateMaxLength(errs, field, website, maxWebsiteLength)
+	u, err := url.Parse(website)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.add(field, "must be an http or https URL")
+	}
+}
+
+func profileFromDB(user database.User, isChirpyRed bool) Profile {
+	profile := Profile{
+		ID:          user.ID,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Location:    user.Location,
+		Website:     user.Website,
+		CreatedAt:   user.CreatedAt,
+		IsChirpyRed: isChirpyRed,
+	}
+	if user.AvatarMediaID.Valid {
+		profile.AvatarMediaID = &user.AvatarMediaID.UUID
+	}
+	return profile
+}
+
+func (cfg *apiConfig) getProfile(w http.ResponseWriter, req *http.Request) {
+	user, err := cfg.db.GetUserByHandle(req.Context(), req.PathValue("handle"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	red, err := cfg.isChirpyRed(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get subscription", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, profileFromDB(user, red))
+}
+
+// getProfileChirps lists a user's chirps, sorted like getChirps.
+func (cfg *apiConfig) getProfileChirps(w http.ResponseWriter, req *http.Request) {
+	if err := cfg.authorizeRead(req, auth.ScopeChirpsRead); err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	user, err := cfg.db.GetUserByHandle(req.Context(), req.PathValue("handle"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	chirps, err := cfg.db.GetChirpsByUser(req.Context(), uuid.NullUUID{UUID: user.ID, Valid: true})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirps", err)
+		return
+	}
+	chirp_structs := []Chirp{}
+	for _, chirp := range chirps {
+		chirp_structs = append(chirp_structs, Chirp{chirp.ID, chirp.CreatedAt, chirp.UpdatedAt, chirp.Body, chirp.UserID.UUID})
+	}
+	sortChirps(chirp_structs, req.URL.Query().Get("sort"))
+	respondWithJSON(w, http.StatusOK, chirp_structs)
+}
@@ -0,0 +1,121 @@
+package main
+
+/*Rate limiting middleware*/
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"example.com/username/bootdev-chirpy/internal/ratelimit"
+	"github.com/google/uuid"
+)
+
+var (
+	loginRateLimit = ratelimit.Policy{Name: "login", Limit: 10, Period: time.Minute}
+	chirpRateLimit = ratelimit.Policy{Name: "chirps", Limit: 30, Period: time.Minute}
+	// Every allowed request to these may send an email.
+	verificationRateLimit  = ratelimit.Policy{Name: "verification", Limit: 5, Period: time.Hour}
+	passwordResetRateLimit = ratelimit.Policy{Name: "password-reset", Limit: 5, Period: time.Hour}
+	// Exports and imports are expensive.
+	exportRateLimit = ratelimit.Policy{Name: "export", Limit: 3, Period: 24 * time.Hour}
+	importRateLimit = ratelimit.Policy{Name: "import", Limit: 5, Period: time.Hour}
+)
+
+// middlewareRateLimit enforces policy per client. Authenticated users get
+// the limit scaled by their plan's entitlements.
+func (cfg *apiConfig) middlewareRateLimit(policy ratelimit.Policy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		client, userID := cfg.rateLimitKey(req)
+		// Scale a copy; the policy is shared by every request.
+		policy := policy
+		if userID != uuid.Nil {
+			ent, err := cfg.entitlementsFor(req.Context(), userID)
+			if err != nil {
+				log.Printf("Couldn't get entitlements for rate limit: %v", err)
+			} else {
+				policy.Limit = ent.ScaleLimit(policy.Limit)
+			}
+		}
+		key := policy.Name + ":" + client
+		res, err := cfg.limiter.Take(req.Context(), key, policy)
+		if err != nil {
+			// Fail open: a broken limiter backend shouldn't take the API down.
+			log.Printf("Rate limiter unavailable: %v", err)
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		w.Header().Set("RateLimit-Policy", policy.String())
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			respondWithError(w, http.StatusTooManyRequests, "Too many requests", nil)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// rateLimitKey identifies the client: authenticated requests are keyed by
+// user so they share a bucket across devices, everything else by IP. The
+// user ID is uuid.Nil for IP keys.
+func (cfg *apiConfig) rateLimitKey(req *http.Request) (string, uuid.UUID) {
+	if token, err := auth.GetBearerToken(req.Header); err == nil {
+		// Only the signature matters for picking a bucket, so skip the
+		// token version lookup.
+		if userID, err := auth.ValidateJWT(token, cfg.keys, nil); err == nil {
+			return "user:" + userID.String(), userID
+		}
+	}
+	return "ip:" + cfg.clientIP(req), uuid.Nil
+}
+
+// loadTrustedProxies reads TRUST_PROXY: how many reverse proxies sit in
+// front of the server, with "true" meaning one.
+func loadTrustedProxies() (int, error) {
+	s := os.Getenv("TRUST_PROXY")
+	switch s {
+	case "", "false":
+		return 0, nil
+	case "true":
+		return 1, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid TRUST_PROXY %q", s)
+	}
+	return n, nil
+}
+
+// clientIP returns the address of the client. X-Forwarded-For is only
+// honoured when running behind trusted proxies, and then only the entry
+// added by the outermost of them: everything to its left came from the
+// client, who could otherwise pick a fresh bucket for every request.
+func (cfg *apiConfig) clientIP(req *http.Request) string {
+	if cfg.trustedProxies > 0 {
+		if fwd := req.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			hops := strings.Split(strings.Join(fwd, ","), ",")
+			i := max(0, len(hops)-cfg.trustedProxies)
+			return strings.TrimSpace(hops[i])
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,94 @@
+package main
+
+/*Stuff related to session management*/
+
+import (
+	"net/http"
+
+	"example.com/username/bootdev-chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) getSessions(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid Token Header!", err)
+		return
+	}
+
+	rows, err := cfg.db.GetActiveSessionsForUser(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get sessions", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, sessionsFromDB(rows))
+}
+
+func sessionsFromDB(rows []database.GetActiveSessionsForUserRow) []Session {
+	sessions := []Session{}
+	for _, row := range rows {
+		sessions = append(sessions, Session{
+			ID:         row.FamilyID,
+			UserAgent:  row.UserAgent,
+			IP:         row.Ip,
+			CreatedAt:  row.StartedAt,
+			LastUsedAt: row.LastUsedAt,
+			ExpiresAt:  row.ExpiresAt,
+		})
+	}
+	return sessions
+}
+
+func (cfg *apiConfig) deleteSession(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid Token Header!", err)
+		return
+	}
+	sessionID, err := uuid.Parse(req.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID", err)
+		return
+	}
+
+	n, err := cfg.db.RevokeSession(req.Context(), database.RevokeSessionParams{
+		FamilyID: sessionID,
+		UserID:   userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "Session not found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) deleteAllSessions(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid Token Header!", err)
+		return
+	}
+
+	err = cfg.db.RevokeAllSessionsForUser(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	// Signed-in apps are logged out too.
+	err = cfg.db.RevokeOAuthRefreshTokensForUser(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke app access", err)
+		return
+	}
+	// Logging out everywhere also kills access tokens that are still live.
+	err = cfg.db.BumpTokenVersion(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
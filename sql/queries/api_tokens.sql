@@ -0,0 +1,36 @@
+-- name: CreateAPIToken :one
+INSERT INTO api_tokens (
+    id, created_at, updated_at, user_id, name, token_hash, scopes, expires_at
+) VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetAPITokensForUser :many
+SELECT * FROM api_tokens
+WHERE user_id = $1 AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: GetAPITokenByHash :one
+SELECT t.*
+FROM api_tokens t
+JOIN users u ON u.id = t.user_id
+WHERE t.token_hash = $1
+  AND (t.revoked_at IS NULL)
+  AND (t.expires_at IS NULL OR t.expires_at > NOW())
+  AND (u.banned_at IS NULL)
+  AND (u.deactivated_at IS NULL);
+
+-- name: TouchAPIToken :exec
+UPDATE api_tokens SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: RevokeAPIToken :execrows
+UPDATE api_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAPITokensForUser :exec
+UPDATE api_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
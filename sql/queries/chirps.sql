@@ -9,11 +9,31 @@ RETURNING *;
 DELETE FROM chirps;
 
 -- name: GetAllChirps :many
-SELECT * FROM chirps ORDER BY created_at ASC;
+SELECT chirps.* FROM chirps
+LEFT JOIN users ON users.id = chirps.user_id
+WHERE users.deactivated_at IS NULL
+ORDER BY chirps.created_at ASC;
 
 -- name: GetChirp :one
-SELECT * FROM chirps WHERE id = $1;
+SELECT chirps.* FROM chirps
+LEFT JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1 AND users.deactivated_at IS NULL;
 
 -- name: DeleteChirpByIDAndUserID :exec
 DELETE FROM chirps
-WHERE id = $1 AND user_id = $2;
\ No newline at end of file
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetChirpsByUser :many
+SELECT * FROM chirps WHERE user_id = $1 ORDER BY created_at ASC;
+
+-- name: ImportChirp :exec
+INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+VALUES (
+    gen_random_uuid(), $1, $1, $2, $3
+);
+
+-- name: UpdateChirp :one
+UPDATE chirps SET body = $3,
+updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
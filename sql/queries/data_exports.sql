@@ -0,0 +1,31 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, created_at, user_id, status, expires_at)
+VALUES (
+    gen_random_uuid(), NOW(), $1, 'pending', $2
+)
+RETURNING id, created_at, user_id, status, completed_at, expires_at;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports SET status = 'ready',
+archive = $2,
+completed_at = NOW(),
+expires_at = $3
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports SET status = 'failed',
+completed_at = NOW(),
+expires_at = $2
+WHERE id = $1;
+
+-- name: GetDataExport :one
+SELECT id, created_at, user_id, status, completed_at, expires_at
+FROM data_exports
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetDataExportArchive :one
+SELECT archive FROM data_exports
+WHERE id = $1 AND status = 'ready' AND expires_at > $2;
+
+-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_exports WHERE expires_at < $1;
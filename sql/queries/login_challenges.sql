@@ -0,0 +1,9 @@
+-- name: SpendLoginChallenge :execrows
+INSERT INTO spent_login_challenges (id, created_at, user_id, expires_at)
+VALUES (
+    $1, NOW(), $2, $3
+)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: DeleteExpiredLoginChallenges :execrows
+DELETE FROM spent_login_challenges WHERE expires_at < $1;
@@ -0,0 +1,41 @@
+-- name: CreateOAuthClient :exec
+INSERT INTO oauth_clients (
+    id, created_at, updated_at, owner_id, name, secret_hash, redirect_uris
+) VALUES (
+    $1, $2, $2, $3, $4, $5, $6
+);
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients WHERE id = $1;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (
+    code_hash, created_at, client_id, user_id, redirect_uri, scope, code_challenge, expires_at
+) VALUES (
+    $1, NOW(), $2, $3, $4, $5, $6, $7
+);
+
+-- name: ConsumeOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL
+RETURNING *;
+
+-- name: CreateOAuthRefreshToken :exec
+INSERT INTO oauth_refresh_tokens (
+    token_hash, created_at, client_id, user_id, scope, expires_at
+) VALUES (
+    $1, NOW(), $2, $3, $4, $5
+);
+
+-- name: ConsumeOAuthRefreshToken :one
+UPDATE oauth_refresh_tokens SET revoked_at = NOW()
+WHERE token_hash = $1 AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeOAuthRefreshToken :exec
+UPDATE oauth_refresh_tokens SET revoked_at = NOW()
+WHERE token_hash = $1 AND client_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeOAuthRefreshTokensForUser :exec
+UPDATE oauth_refresh_tokens SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
@@ -0,0 +1,13 @@
+-- name: CreatePasswordReset :exec
+INSERT INTO password_resets (token_hash, created_at, user_id, expires_at, used_at)
+VALUES (
+    $1, NOW(), $2, $3, NULL
+);
+
+-- name: ConsumePasswordReset :one
+UPDATE password_resets SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+RETURNING user_id;
+
+-- name: DeletePasswordResetsForUser :exec
+DELETE FROM password_resets WHERE user_id = $1;
@@ -1,13 +1,43 @@
 -- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (
-    token, created_at, updated_at, user_id, expires_at, revoked_at
+    token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id,
+    user_agent, ip, last_used_at
 ) VALUES (
-    $1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', NULL
+    $1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', NULL, $3,
+    $4, $5, NOW()
 )
 RETURNING *;
 
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens WHERE token_hash = $1;
+
 -- name: RevokeRefreshToken :one
 UPDATE refresh_tokens SET revoked_at = NOW(),
-updated_at = NOW()
-WHERE token = $1
+updated_at = NOW(),
+replaced_by_hash = $2
+WHERE token_hash = $1 AND revoked_at IS NULL
 RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: GetActiveSessionsForUser :many
+SELECT rt.family_id, rt.user_agent, rt.ip, rt.last_used_at, rt.expires_at,
+    (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = rt.family_id)::timestamp AS started_at
+FROM refresh_tokens rt
+WHERE rt.user_id = $1
+  AND (rt.revoked_at IS NULL)
+  AND (rt.expires_at > NOW())
+ORDER BY rt.last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllSessionsForUser :exec
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
@@ -0,0 +1,32 @@
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_end, provider, provider_ref)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT (user_id) DO UPDATE SET plan = EXCLUDED.plan,
+status = EXCLUDED.status,
+current_period_end = CASE WHEN subscriptions.provider = EXCLUDED.provider
+    THEN COALESCE(EXCLUDED.current_period_end, subscriptions.current_period_end)
+    ELSE EXCLUDED.current_period_end END,
+provider = EXCLUDED.provider,
+provider_ref = CASE WHEN subscriptions.provider = EXCLUDED.provider
+    THEN COALESCE(EXCLUDED.provider_ref, subscriptions.provider_ref)
+    ELSE EXCLUDED.provider_ref END,
+updated_at = NOW()
+WHERE subscriptions.provider = EXCLUDED.provider
+   OR subscriptions.status NOT IN ('active', 'past_due')
+   OR subscriptions.current_period_end < NOW()
+RETURNING *;
+
+-- name: GetSubscriptionByUser :one
+SELECT * FROM subscriptions WHERE user_id = $1;
+
+-- name: SetSubscriptionStatus :exec
+UPDATE subscriptions SET status = $2,
+updated_at = NOW()
+WHERE user_id = $1 AND provider = $3 AND status IN ('active', 'past_due');
+
+-- name: ExpireSubscriptions :execrows
+UPDATE subscriptions SET status = 'expired',
+updated_at = NOW()
+WHERE status IN ('active', 'past_due') AND current_period_end < $1;
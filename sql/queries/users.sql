@@ -1,24 +1,12 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, password)
+INSERT INTO users (id, created_at, updated_at, email, password, handle)
 VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3
 )
 RETURNING *;
 
--- name: UpdateUser :one
-UPDATE users SET email=$2, password = $3,
-updated_at = NOW()
-WHERE id = $1
-RETURNING *;
-
--- name: UpgradeUser :one
-UPDATE users SET is_chirpy_red = TRUE,
-updated_at = NOW()
-WHERE id = $1
-RETURNING *;
-
 -- name: GetUserByMail :one
-SELECT * from users where email = $1 ORDER BY created_at ASC LIMIT 1;
+SELECT * from users where lower(email) = lower(sqlc.arg(email));
 
 -- name: DeleteAllUsers :exec
 DELETE FROM users;
@@ -27,6 +15,128 @@ DELETE FROM users;
 SELECT u.*
 FROM users u
 JOIN refresh_tokens rt ON rt.user_id = u.id
-WHERE rt.token = $1
+WHERE rt.token_hash = $1
   AND (rt.revoked_at IS NULL)
-  AND (rt.expires_at > NOW());
\ No newline at end of file
+  AND (rt.expires_at > NOW());
+
+-- name: RecordFailedLogin :one
+UPDATE users SET failed_login_attempts = failed_login_attempts + 1
+WHERE id = $1
+RETURNING failed_login_attempts;
+
+-- name: LockUser :exec
+UPDATE users SET failed_login_attempts = 0, locked_until = $2
+WHERE id = $1;
+
+-- name: UnlockUser :one
+UPDATE users SET failed_login_attempts = 0, locked_until = NULL
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserTokenVersion :one
+SELECT token_version FROM users WHERE id = $1;
+
+-- name: BumpTokenVersion :exec
+UPDATE users SET token_version = token_version + 1
+WHERE id = $1;
+
+-- name: BanUser :one
+UPDATE users SET banned_at = NOW(),
+token_version = token_version + 1,
+updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UnbanUser :one
+UPDATE users SET banned_at = NULL,
+updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: SetTOTPSecret :exec
+UPDATE users SET totp_secret = $2,
+totp_enabled_at = NULL,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: EnableTOTP :exec
+UPDATE users SET totp_enabled_at = NOW(),
+totp_last_step = $2,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: DisableTOTP :exec
+UPDATE users SET totp_secret = NULL,
+totp_enabled_at = NULL,
+totp_last_step = 0,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: RecordTOTPStep :execrows
+UPDATE users SET totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2;
+
+-- name: VerifyUserEmail :execrows
+UPDATE users SET email_verified_at = NOW(),
+updated_at = NOW()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL;
+
+-- name: ResetPassword :exec
+UPDATE users SET password = $2,
+token_version = token_version + 1,
+failed_login_attempts = 0,
+locked_until = NULL,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: RehashPassword :exec
+UPDATE users SET password = $2
+WHERE id = $1;
+
+-- name: SetPendingEmail :exec
+UPDATE users SET pending_email = $2,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: ConfirmEmailChange :execrows
+UPDATE users SET email = pending_email,
+pending_email = NULL,
+email_verified_at = NOW(),
+updated_at = NOW()
+WHERE id = $1 AND pending_email = $2;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE lower(handle) = lower(sqlc.arg(handle))
+  AND banned_at IS NULL AND deactivated_at IS NULL;
+
+-- name: UpdateProfile :one
+UPDATE users SET handle = $2,
+display_name = $3,
+bio = $4,
+avatar_media_id = $5,
+location = $6,
+website = $7,
+updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeactivateUser :exec
+UPDATE users SET deactivated_at = $2,
+token_version = token_version + 1,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: ReactivateUser :exec
+UPDATE users SET deactivated_at = NULL,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetUsersToPurge :many
+SELECT id FROM users WHERE deactivated_at < $1;
+
+-- name: PurgeUser :execrows
+DELETE FROM users WHERE id = $1 AND deactivated_at < $2;
@@ -0,0 +1,34 @@
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, created_at, updated_at, provider, event_id, event_type, payload, status)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, 'received'
+)
+ON CONFLICT (provider, event_id) DO NOTHING
+RETURNING *;
+
+-- name: ClaimWebhookEvent :one
+UPDATE webhook_events SET status = 'received',
+updated_at = NOW()
+WHERE id = $1
+  AND (status = 'failed' OR (status = 'received' AND updated_at < sqlc.arg(stale_before)))
+RETURNING *;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events WHERE id = $1;
+
+-- name: GetWebhookEventByEventID :one
+SELECT * FROM webhook_events WHERE provider = $1 AND event_id = $2;
+
+-- name: ListWebhookEvents :many
+SELECT * FROM webhook_events
+WHERE (sqlc.narg(status)::text IS NULL OR status = sqlc.narg(status))
+ORDER BY created_at DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: RecordWebhookOutcome :exec
+UPDATE webhook_events SET status = $2,
+error = $3,
+attempts = attempts + 1,
+processed_at = NOW(),
+updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- Existing rows hold plaintext tokens that can't be converted without
+-- keeping them readable, so every session ends and users log in again.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN replaced_by TO replaced_by_hash;
+
+-- +goose Down
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN replaced_by_hash TO replaced_by;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN banned_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN token_version,
+DROP COLUMN banned_at;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+
+-- Accounts from before verification existed are trusted as they are, so a
+-- stricter policy doesn't lock them out.
+UPDATE users SET email_verified_at = created_at;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN email_verified_at;
@@ -0,0 +1,21 @@
+-- +goose Up
+UPDATE users SET email = lower(trim(email));
+UPDATE users SET pending_email = lower(trim(pending_email))
+WHERE pending_email IS NOT NULL;
+
+-- Logins used to go to the oldest account with an email, so that one keeps
+-- it. The others get a placeholder address nobody can receive mail at,
+-- which keeps their data around for an admin to sort out.
+UPDATE users SET email = users.id || '@duplicate.invalid',
+pending_email = NULL,
+updated_at = NOW()
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY email ORDER BY created_at, id) AS n
+    FROM users
+) dupes
+WHERE users.id = dupes.id AND dupes.n > 1;
+
+CREATE UNIQUE INDEX users_email_lower_idx ON users (lower(email));
+
+-- +goose Down
+DROP INDEX users_email_lower_idx;
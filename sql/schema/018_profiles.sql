@@ -0,0 +1,26 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN handle TEXT,
+ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+-- There's no media table to reference yet.
+ADD COLUMN avatar_media_id UUID,
+ADD COLUMN location TEXT NOT NULL DEFAULT '',
+ADD COLUMN website TEXT NOT NULL DEFAULT '';
+
+UPDATE users SET handle = 'user_' || left(replace(id::text, '-', ''), 12);
+
+ALTER TABLE users ALTER COLUMN handle SET NOT NULL;
+
+CREATE UNIQUE INDEX users_handle_lower_idx ON users (lower(handle));
+
+-- +goose Down
+DROP INDEX users_handle_lower_idx;
+
+ALTER TABLE users
+DROP COLUMN handle,
+DROP COLUMN display_name,
+DROP COLUMN bio,
+DROP COLUMN avatar_media_id,
+DROP COLUMN location,
+DROP COLUMN website;
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN deactivated_at TIMESTAMP;
+
+CREATE INDEX users_deactivated_at_idx ON users (deactivated_at)
+WHERE deactivated_at IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN deactivated_at;
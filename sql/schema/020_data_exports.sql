@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    archive BYTEA
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id);
+
+-- +goose Down
+DROP TABLE data_exports;
@@ -0,0 +1,33 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL,
+    current_period_end TIMESTAMP,
+    provider TEXT NOT NULL,
+    provider_ref TEXT
+);
+
+-- Upgrades recorded by the old flag never had a period, so they stay
+-- active until the provider tells us otherwise.
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, provider)
+SELECT gen_random_uuid(), NOW(), NOW(), id, 'chirpy_red', 'active', 'polka'
+FROM users
+WHERE is_chirpy_red;
+
+ALTER TABLE users
+DROP COLUMN is_chirpy_red;
+
+-- +goose Down
+ALTER TABLE users
+ADD COLUMN is_chirpy_red BOOLEAN DEFAULT FALSE;
+
+UPDATE users SET is_chirpy_red = TRUE
+WHERE id IN (
+    SELECT user_id FROM subscriptions WHERE status IN ('active', 'past_due')
+);
+
+DROP TABLE subscriptions;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE spent_login_challenges (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE spent_login_challenges;
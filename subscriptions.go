@@ -0,0 +1,151 @@
+package main
+
+/*Stuff related to Chirpy Red subscriptions*/
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/database"
+	"example.com/username/bootdev-chirpy/internal/entitlements"
+	"github.com/google/uuid"
+)
+
+const (
+	planChirpyRed = "chirpy_red"
+
+	subscriptionActive   = "active"
+	subscriptionPastDue  = "past_due"
+	subscriptionCanceled = "canceled"
+	subscriptionExpired  = "expired"
+)
+
+// Subscription is the caller's view of their plan and what it currently
+// unlocks. Users who never subscribed get plan "free" with status "none".
+type Subscription struct {
+	Plan             string                    `json:"plan"`
+	Status           string                    `json:"status"`
+	Active           bool                      `json:"active"`
+	CurrentPeriodEnd *time.Time                `json:"current_period_end"`
+	Provider         string                    `json:"provider,omitempty"`
+	UpdatedAt        *time.Time                `json:"updated_at,omitempty"`
+	Entitlements     entitlements.Entitlements `json:"entitlements"`
+}
+
+// loadEntitlements reads ENTITLEMENTS_FILE, a JSON object of plan name to
+// entitlements applied on top of the built-in plans.
+func loadEntitlements() (entitlements.Table, error) {
+	path := os.Getenv("ENTITLEMENTS_FILE")
+	if path == "" {
+		return entitlements.Default(), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	table, err := entitlements.Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return table, nil
+}
+
+// subscriptionIsActive reports whether sub still grants its plan at now.
+// A failed payment keeps the plan until the paid-for period runs out; a
+// subscription without a period end lasts until it is canceled.
+func subscriptionIsActive(sub database.Subscription, now time.Time) bool {
+	if sub.Status != subscriptionActive && sub.Status != subscriptionPastDue {
+		return false
+	}
+	return !sub.CurrentPeriodEnd.Valid || sub.CurrentPeriodEnd.Time.After(now)
+}
+
+func (cfg *apiConfig) subscriptionFromDB(sub database.Subscription, now time.Time) Subscription {
+	resp := Subscription{
+		Plan:         sub.Plan,
+		Status:       sub.Status,
+		Active:       subscriptionIsActive(sub, now),
+		Provider:     sub.Provider,
+		UpdatedAt:    &sub.UpdatedAt,
+		Entitlements: cfg.entitlements.For(entitlements.Free),
+	}
+	if resp.Active {
+		resp.Entitlements = cfg.entitlements.For(sub.Plan)
+	}
+	if sub.CurrentPeriodEnd.Valid {
+		resp.CurrentPeriodEnd = &sub.CurrentPeriodEnd.Time
+	}
+	return resp
+}
+
+// entitlementsFor returns what userID's plan unlocks right now. Users
+// without an active subscription get the free plan.
+func (cfg *apiConfig) entitlementsFor(ctx context.Context, userID uuid.UUID) (entitlements.Entitlements, error) {
+	sub, err := cfg.db.GetSubscriptionByUser(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cfg.entitlements.For(entitlements.Free), nil
+	}
+	if err != nil {
+		return entitlements.Entitlements{}, err
+	}
+	if !subscriptionIsActive(sub, time.Now().UTC()) {
+		return cfg.entitlements.For(entitlements.Free), nil
+	}
+	return cfg.entitlements.For(sub.Plan), nil
+}
+
+// isChirpyRed reports whether userID currently has an active Chirpy Red
+// subscription.
+func (cfg *apiConfig) isChirpyRed(ctx context.Context, userID uuid.UUID) (bool, error) {
+	sub, err := cfg.db.GetSubscriptionByUser(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return sub.Plan == planChirpyRed && subscriptionIsActive(sub, time.Now().UTC()), nil
+}
+
+func (cfg *apiConfig) getSubscription(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	sub, err := cfg.db.GetSubscriptionByUser(req.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, http.StatusOK, Subscription{
+			Plan:         entitlements.Free,
+			Status:       "none",
+			Entitlements: cfg.entitlements.For(entitlements.Free),
+		})
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get subscription", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.subscriptionFromDB(sub, time.Now().UTC()))
+}
+
+// expireSubscriptions marks subscriptions whose period ended without a
+// renewal, so their status stops claiming they are active.
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context) {
+	now := time.Now().UTC()
+	n, err := cfg.db.ExpireSubscriptions(ctx, sql.NullTime{Time: now, Valid: true})
+	if err != nil {
+		log.Printf("Couldn't expire subscriptions: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Expired %d subscriptions", n)
+	}
+}
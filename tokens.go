@@ -0,0 +1,141 @@
+package main
+
+/*Stuff related to personal access tokens*/
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"example.com/username/bootdev-chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxAPITokenNameLength = 100
+
+func apiTokenFromDB(token database.ApiToken) APIToken {
+	scopes, _ := auth.ParseScopes(token.Scopes)
+	apiToken := APIToken{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scopes:    scopes,
+		CreatedAt: token.CreatedAt,
+	}
+	if token.ExpiresAt.Valid {
+		apiToken.ExpiresAt = &token.ExpiresAt.Time
+	}
+	if token.LastUsedAt.Valid {
+		apiToken.LastUsedAt = &token.LastUsedAt.Time
+	}
+	return apiToken
+}
+
+// createAPIToken only accepts first-party access tokens, so a leaked
+// personal access token can't be used to mint more of them.
+func (cfg *apiConfig) createAPIToken(w http.ResponseWriter, req *http.Request) {
+	type tokenParameters struct {
+		Name          string       `json:"name"`
+		Scopes        []auth.Scope `json:"scopes"`
+		ExpiresInDays int          `json:"expires_in_days"`
+	}
+
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	params := tokenParameters{}
+	err = json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters", err)
+		return
+	}
+	if params.Name == "" || len(params.Name) > maxAPITokenNameLength {
+		respondWithError(w, http.StatusBadRequest, "Name must be between 1 and 100 characters", nil)
+		return
+	}
+	if len(params.Scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one scope is required", nil)
+		return
+	}
+	scopes, err := auth.ParseScopes(auth.FormatScopes(params.Scopes))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if params.ExpiresInDays < 0 {
+		respondWithError(w, http.StatusBadRequest, "expires_in_days can't be negative", nil)
+		return
+	}
+	expiresAt := sql.NullTime{}
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().UTC().AddDate(0, 0, params.ExpiresInDays), Valid: true}
+	}
+
+	key, err := auth.MakeAPIKey()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate token...", err)
+		return
+	}
+	token, err := cfg.db.CreateAPIToken(req.Context(), database.CreateAPITokenParams{
+		UserID:    userID,
+		Name:      params.Name,
+		TokenHash: auth.HashToken(key),
+		Scopes:    auth.FormatScopes(scopes),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save token", err)
+		return
+	}
+
+	apiToken := apiTokenFromDB(token)
+	apiToken.Token = key
+	respondWithJSON(w, http.StatusCreated, apiToken)
+}
+
+func (cfg *apiConfig) getAPITokens(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	tokens, err := cfg.db.GetAPITokensForUser(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get tokens", err)
+		return
+	}
+	apiTokens := []APIToken{}
+	for _, token := range tokens {
+		apiTokens = append(apiTokens, apiTokenFromDB(token))
+	}
+	respondWithJSON(w, http.StatusOK, apiTokens)
+}
+
+func (cfg *apiConfig) deleteAPIToken(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	tokenID, err := uuid.Parse(req.PathValue("tokenID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid token ID", err)
+		return
+	}
+	n, err := cfg.db.RevokeAPIToken(req.Context(), database.RevokeAPITokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token", err)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "Token not found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,318 @@
+package main
+
+/*Stuff related to TOTP two-factor authentication*/
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"example.com/username/bootdev-chirpy/internal/database"
+)
+
+const (
+	totpIssuer         = "Chirpy"
+	challengeExpiresIn = 5 * time.Minute
+	recoveryCodeCount  = 10
+)
+
+type twoFactorParameters struct {
+	Password       string `json:"password"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+	ChallengeToken string `json:"challenge_token"`
+}
+
+// enrollTwoFactor stores a fresh TOTP secret for the user. It isn't enforced
+// at login until confirmTwoFactor has seen a code generated from it.
+func (cfg *apiConfig) enrollTwoFactor(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	params := twoFactorParameters{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters", err)
+		return
+	}
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	err = cfg.checkCurrentPassword(req, user, params.Password)
+	if errors.Is(err, errAccountLocked) {
+		respondWithError(w, http.StatusForbidden, "Account locked, try again later", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Incorrect password", err)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate secret", err)
+		return
+	}
+	err = cfg.db.SetTOTPSecret(req.Context(), database.SetTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save secret", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, user.Email, totpIssuer),
+	})
+}
+
+// confirmTwoFactor turns on two-factor authentication once the user proves
+// their authenticator works, and hands out the recovery codes. They are
+// only ever shown here.
+func (cfg *apiConfig) confirmTwoFactor(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	params := twoFactorParameters{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters", err)
+		return
+	}
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(w, http.StatusBadRequest, "Two-factor authentication hasn't been set up", nil)
+		return
+	}
+	step, err := auth.ValidateTOTP(user.TotpSecret.String, params.Code, time.Now().UTC())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid code", err)
+		return
+	}
+
+	codes, err := cfg.replaceRecoveryCodes(req, user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+	err = cfg.db.EnableTOTP(req.Context(), database.EnableTOTPParams{
+		ID:           user.ID,
+		TotpLastStep: step,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{RecoveryCodes: codes})
+}
+
+// disableTwoFactor needs both the password and a current code, so a stolen
+// session alone can't switch it off.
+func (cfg *apiConfig) disableTwoFactor(w http.ResponseWriter, req *http.Request) {
+	params := twoFactorParameters{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters", err)
+		return
+	}
+	userID, err := cfg.authenticate(req)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Two-factor authentication isn't enabled", nil)
+		return
+	}
+	err = cfg.checkCurrentPassword(req, user, params.Password)
+	if errors.Is(err, errAccountLocked) {
+		respondWithError(w, http.StatusForbidden, "Account locked, try again later", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Incorrect password", err)
+		return
+	}
+	err = cfg.checkSecondFactor(req, user, params)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code", err)
+		return
+	}
+
+	err = cfg.db.DisableTOTP(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+	err = cfg.db.DeleteRecoveryCodesForUser(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete recovery codes", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loginTwoFactor completes a login that was answered with a challenge
+// token. Failures count against the account and the client IP just like a
+// wrong password does, and each challenge is good for one attempt.
+func (cfg *apiConfig) loginTwoFactor(w http.ResponseWriter, req *http.Request) {
+	params := twoFactorParameters{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters", err)
+		return
+	}
+	challenge, err := auth.ValidateChallengeJWT(params.ChallengeToken, cfg.keys)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge", err)
+		return
+	}
+	user, err := cfg.db.GetUserByID(req.Context(), challenge.UserID)
+	if err != nil || !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge", err)
+		return
+	}
+	n, err := cfg.db.SpendLoginChallenge(req.Context(), database.SpendLoginChallengeParams{
+		ID:        challenge.ID,
+		UserID:    user.ID,
+		ExpiresAt: challenge.ExpiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check challenge", err)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge", nil)
+		return
+	}
+	if user.BannedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Account suspended", nil)
+		return
+	}
+	if isLocked(user) {
+		// Don't spend a recovery code on an account that can't log in yet.
+		cfg.loginFailed(req, &user)
+		respondWithError(w, http.StatusUnauthorized, "Invalid code", nil)
+		return
+	}
+	err = cfg.checkSecondFactor(req, user, params)
+	if err != nil {
+		cfg.loginFailed(req, &user)
+		respondWithError(w, http.StatusUnauthorized, "Invalid code", err)
+		return
+	}
+	if user.FailedLoginAttempts > 0 || user.LockedUntil.Valid {
+		_, err = cfg.db.UnlockUser(req.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't reset login attempts", err)
+			return
+		}
+	}
+
+	cfg.completeLogin(w, req, user)
+}
+
+// checkSecondFactor accepts either a TOTP code that hasn't been used before
+// or an unused recovery code, which is then spent.
+func (cfg *apiConfig) checkSecondFactor(req *http.Request, user database.User, params twoFactorParameters) error {
+	if params.RecoveryCode != "" {
+		n, err := cfg.db.UseRecoveryCode(req.Context(), database.UseRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(params.RecoveryCode)),
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errors.New("unknown or used recovery code")
+		}
+		return nil
+	}
+
+	step, err := auth.ValidateTOTP(user.TotpSecret.String, params.Code, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	n, err := cfg.db.RecordTOTPStep(req.Context(), database.RecordTOTPStepParams{
+		ID:           user.ID,
+		TotpLastStep: step,
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("TOTP code already used")
+	}
+	return nil
+}
+
+func (cfg *apiConfig) replaceRecoveryCodes(req *http.Request, user database.User) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.db.DeleteRecoveryCodesForUser(req.Context(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		err = cfg.db.CreateRecoveryCode(req.Context(), database.CreateRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: auth.HashToken(code),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// purgeSpentChallenges forgets spent challenges once they have expired and
+// couldn't be used anyway.
+func (cfg *apiConfig) purgeSpentChallenges(ctx context.Context) {
+	_, err := cfg.db.DeleteExpiredLoginChallenges(ctx, time.Now().UTC())
+	if err != nil {
+		log.Printf("Couldn't delete spent login challenges: %v", err)
+	}
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 
 	"example.com/username/bootdev-chirpy/internal/auth"
 	"example.com/username/bootdev-chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
-func (cfg *apiConfig) updateUser(w http.ResponseWriter, req *http.Request) {
+func (cfg *apiConfig) createUser(w http.ResponseWriter, req *http.Request) {
 	decoder := json.NewDecoder(req.Body)
 	params := parameters{}
 	err := decoder.Decode(&params)
@@ -18,18 +22,26 @@ func (cfg *apiConfig) updateUser(w http.ResponseWriter, req *http.Request) {
 		w.Write([]byte("Error decoding parameters"))
 		return
 	}
-	token, err := auth.GetBearerToken((req.Header))
-	if err != nil {
-		w.WriteHeader(401)
-		w.Write([]byte("Invalid Token Header!"))
-		return
+
+	params.Email = normalizeEmail(params.Email)
+	errs := fieldErrors{}
+	validateEmail(errs, "email", params.Email)
+	cfg.checkPassword(errs, "password", params.Password, params.Email)
+	if params.Handle != "" {
+		validateHandle(errs, "handle", params.Handle)
 	}
-	userId, err := auth.ValidateJWT(token, cfg.secret)
-	if err != nil {
-		w.WriteHeader(401)
-		w.Write([]byte("Invalid Token Header!"))
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
 		return
 	}
+	if params.Handle == "" {
+		params.Handle, err = generateHandle()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate handle", err)
+			return
+		}
+	}
+
 	hash, err := auth.HashPassword(params.Password)
 	if err != nil {
 		w.WriteHeader(500)
@@ -37,46 +49,296 @@ func (cfg *apiConfig) updateUser(w http.ResponseWriter, req *http.Request) {
 		fmt.Println(err)
 		return
 	}
-	param_struct := database.UpdateUserParams{ID: userId, Password: hash, Email: params.Email}
-	user, err := cfg.db.UpdateUser(req.Context(), param_struct)
+	param_struct := database.CreateUserParams{Password: hash, Email: params.Email, Handle: params.Handle}
+	user, err := cfg.db.CreateUser(req.Context(), param_struct)
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, conflictMessage(err), err)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(fmt.Sprintf("Error creating user %v", err)))
 		fmt.Println(err)
 		return
 	}
-	user_struct := User{user.ID, user.CreatedAt, user.UpdatedAt, user.Email, "", "", user.IsChirpyRed.Bool}
-	respondWithJSON(w, 200, user_struct)
+	err = cfg.sendVerificationEmail(req.Context(), user)
+	if err != nil {
+		// The account exists either way; the user can ask for a new link.
+		log.Printf("Couldn't send verification email to user %s: %v", user.ID, err)
+	}
+	user_struct := User{user.ID, user.CreatedAt, user.UpdatedAt, user.Email, "", "", false}
+	respondWithJSON(w, 201, user_struct)
 }
 
-func (cfg *apiConfig) createUser(w http.ResponseWriter, req *http.Request) {
-	decoder := json.NewDecoder(req.Body)
-	params := parameters{}
-	err := decoder.Decode(&params)
+// userUpdate holds the account fields a request changes; nil fields are
+// left alone.
+type userUpdate struct {
+	Email           *string `json:"email"`
+	Password        *string `json:"password"`
+	CurrentPassword string  `json:"current_password"`
+	Handle          *string `json:"handle"`
+	DisplayName     *string `json:"display_name"`
+	Bio             *string `json:"bio"`
+	// AvatarMediaID is cleared by sending an empty string.
+	AvatarMediaID *string `json:"avatar_media_id"`
+	Location      *string `json:"location"`
+	Website       *string `json:"website"`
+}
+
+// updateUser is the older way to change email and password, both at once.
+// It goes through the same checks as patchUser.
+func (cfg *apiConfig) updateUser(w http.ResponseWriter, req *http.Request) {
+	type updateParameters struct {
+		Email           string `json:"email"`
+		Password        string `json:"password"`
+		CurrentPassword string `json:"current_password"`
+	}
+
+	params := updateParameters{}
+	err := json.NewDecoder(req.Body).Decode(&params)
 	if err != nil {
-		w.WriteHeader(500)
-		w.Write([]byte("Error decoding parameters"))
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters", err)
+		return
+	}
+	cfg.updateAccount(w, req, userUpdate{
+		Email:           &params.Email,
+		Password:        &params.Password,
+		CurrentPassword: params.CurrentPassword,
+	})
+}
+
+// patchUser updates only the fields present in the request.
+func (cfg *apiConfig) patchUser(w http.ResponseWriter, req *http.Request) {
+	params := userUpdate{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters", err)
 		return
 	}
+	cfg.updateAccount(w, req, params)
+}
+
+// updateAccount applies an update for the caller. Changing the password or
+// email needs the current password, so a stolen session can't take over the
+// account, and a new email only takes effect once the link mailed to it is
+// followed.
+func (cfg *apiConfig) updateAccount(w http.ResponseWriter, req *http.Request, params userUpdate) {
+	type response struct {
+		User
+		PendingEmail string  `json:"pending_email,omitempty"`
+		Profile      Profile `json:"profile"`
+	}
 
-	if params.Email != "" || params.Password != "" {
-		hash, err := auth.HashPassword(params.Password)
+	userID, err := cfg.authorize(req, auth.ScopeProfileWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	if params.Email != nil || params.Password != nil {
+		// profile:write covers the profile only. Credentials, and the new
+		// session a password change hands back, need a first-party token.
+		userID, err = cfg.authenticate(req)
 		if err != nil {
-			w.WriteHeader(500)
-			w.Write([]byte(fmt.Sprintf("Error creating hash %v", err)))
-			fmt.Println(err)
+			respondWithAuthError(w, err)
 			return
 		}
-		param_struct := database.CreateUserParams{Password: hash, Email: params.Email}
-		user, err := cfg.db.CreateUser(req.Context(), param_struct)
+	}
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	if params.Email != nil {
+		email := normalizeEmail(*params.Email)
+		params.Email = &email
+		if email == user.Email {
+			params.Email = nil
+		}
+	}
+	errs := fieldErrors{}
+	if params.Email != nil {
+		validateEmail(errs, "email", *params.Email)
+	}
+	if params.Password != nil {
+		cfg.checkPassword(errs, "password", *params.Password, user.Email)
+	}
+	profile := database.UpdateProfileParams{
+		ID:            user.ID,
+		Handle:        user.Handle,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarMediaID: user.AvatarMediaID,
+		Location:      user.Location,
+		Website:       user.Website,
+	}
+	profileChanged := false
+	if params.Handle != nil {
+		validateHandle(errs, "handle", *params.Handle)
+		profile.Handle, profileChanged = *params.Handle, true
+	}
+	if params.DisplayName != nil {
+		validateMaxLength(errs, "display_name", *params.DisplayName, maxDisplayNameLength)
+		profile.DisplayName, profileChanged = *params.DisplayName, true
+	}
+	if params.Bio != nil {
+		validateMaxLength(errs, "bio", *params.Bio, maxBioLength)
+		profile.Bio, profileChanged = *params.Bio, true
+	}
+	if params.AvatarMediaID != nil {
+		profile.AvatarMediaID, profileChanged = uuid.NullUUID{}, true
+		if *params.AvatarMediaID != "" {
+			id, err := uuid.Parse(*params.AvatarMediaID)
+			if err != nil {
+				errs.add("avatar_media_id", "is not a valid ID")
+			}
+			profile.AvatarMediaID = uuid.NullUUID{UUID: id, Valid: true}
+		}
+	}
+	if params.Location != nil {
+		validateMaxLength(errs, "location", *params.Location, maxLocationLength)
+		profile.Location, profileChanged = *params.Location, true
+	}
+	if params.Website != nil {
+		validateWebsite(errs, "website", *params.Website)
+		profile.Website, profileChanged = *params.Website, true
+	}
+	if (params.Email != nil || params.Password != nil) && params.CurrentPassword == "" {
+		errs.add("current_password", "is required to change email or password")
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+	if params.Email != nil || params.Password != nil {
+		err = cfg.checkCurrentPassword(req, user, params.CurrentPassword)
+		if errors.Is(err, errAccountLocked) {
+			respondWithError(w, http.StatusForbidden, "Account locked, try again later", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusForbidden, "Current password is incorrect", err)
+			return
+		}
+	}
+
+	if params.Email != nil {
+		// The address is only claimed once confirmed, but there's no point
+		// sending a link that can't work.
+		_, err = cfg.db.GetUserByMail(req.Context(), *params.Email)
+		if err == nil {
+			respondWithError(w, http.StatusConflict, "Email already in use", nil)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check email", err)
+			return
+		}
+	}
+
+	red, err := cfg.isChirpyRed(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get subscription", err)
+		return
+	}
+	var hash string
+	if params.Password != nil {
+		hash, err = auth.HashPassword(*params.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+			return
+		}
+	}
+
+	// Everything is written in one go, so a taken handle leaves the password
+	// and email as they were. Tokens and mail only go out once it's committed.
+	tx, err := cfg.conn.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start update", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+	if profileChanged {
+		_, err = qtx.UpdateProfile(req.Context(), profile)
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, conflictMessage(err), err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update profile", err)
+			return
+		}
+	}
+	if params.Password != nil {
+		err = qtx.ResetPassword(req.Context(), database.ResetPasswordParams{
+			ID:       user.ID,
+			Password: hash,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update password", err)
+			return
+		}
+		// Other sessions end and the caller carries on with new tokens.
+		err = qtx.RevokeAllSessionsForUser(req.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+			return
+		}
+		err = qtx.RevokeOAuthRefreshTokensForUser(req.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't revoke app access", err)
+			return
+		}
+		err = qtx.RevokeAPITokensForUser(req.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't revoke API tokens", err)
+			return
+		}
+	}
+	if params.Email != nil {
+		err = qtx.SetPendingEmail(req.Context(), database.SetPendingEmailParams{
+			ID:           user.ID,
+			PendingEmail: sql.NullString{String: *params.Email, Valid: true},
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update email", err)
+			return
+		}
+	}
+	user, err = qtx.GetUserByID(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+		return
+	}
+
+	resp := response{}
+	if params.Password != nil {
+		resp.Token, resp.RefreshToken, err = cfg.issueTokens(req, user, uuid.New())
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to generate token...", err)
+			return
+		}
+	}
+	if params.Email != nil {
+		err = cfg.sendEmailChangeConfirmation(req.Context(), user, *params.Email)
 		if err != nil {
-			w.WriteHeader(500)
-			w.Write([]byte(fmt.Sprintf("Error creating user %v", err)))
-			fmt.Println(err)
+			respondWithError(w, http.StatusInternalServerError, "Couldn't send confirmation email", err)
 			return
 		}
-		user_struct := User{user.ID, user.CreatedAt, user.UpdatedAt, user.Email, "", "", user.IsChirpyRed.Bool}
-		respondWithJSON(w, 201, user_struct)
+		resp.PendingEmail = *params.Email
 	}
 
+	resp.ID = user.ID
+	resp.CreatedAt = user.CreatedAt
+	resp.UpdatedAt = user.UpdatedAt
+	resp.Email = user.Email
+	resp.IsChirpyRed = red
+	resp.Profile = profileFromDB(user, red)
+	respondWithJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,156 @@
+package main
+
+/*Stuff related to validating user input*/
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"example.com/username/bootdev-chirpy/internal/password"
+	"github.com/lib/pq"
+)
+
+// fieldErrors maps request fields to what's wrong with them.
+type fieldErrors map[string][]string
+
+func (e fieldErrors) add(field string, problems ...string) {
+	if len(problems) > 0 {
+		e[field] = append(e[field], problems...)
+	}
+}
+
+func respondWithFieldErrors(w http.ResponseWriter, errs fieldErrors) {
+	type errorResponse struct {
+		Error  string      `json:"error"`
+		Fields fieldErrors `json:"fields"`
+	}
+	respondWithJSON(w, http.StatusBadRequest, errorResponse{
+		Error:  "Invalid parameters",
+		Fields: errs,
+	})
+}
+
+// normalizeEmail is applied to every address before it is stored, so the
+// unique index on lower(email) sees what the user meant.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// isUniqueViolation reports whether err is Postgres refusing a duplicate
+// value for a unique index.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is Postgres refusing a row
+// that points at something which doesn't exist.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// conflictMessage explains which unique field of users a violation was
+// about.
+func conflictMessage(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Constraint == "users_handle_lower_idx" {
+		return "Handle already taken"
+	}
+	return "Email already in use"
+}
+
+func validateEmail(errs fieldErrors, field, email string) {
+	if email == "" {
+		errs.add(field, "is required")
+		return
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		errs.add(field, "is not a valid email address")
+	}
+}
+
+// checkPassword applies the password policy. If the breached-password
+// corpus can't be read the other rules still apply, so an unreadable file
+// doesn't stop everyone from signing up.
+func (cfg *apiConfig) checkPassword(errs fieldErrors, field, pw string, userInputs ...string) {
+	problems, err := cfg.passwords.Check(pw, userInputs...)
+	if err != nil {
+		log.Printf("Couldn't check breached passwords: %v", err)
+	}
+	errs.add(field, problems...)
+}
+
+// loadArgon2Params applies ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and
+// ARGON2_PARALLELISM on top of auth.DefaultArgon2Params.
+func loadArgon2Params() error {
+	p := auth.DefaultArgon2Params
+	for _, setting := range []struct {
+		env  string
+		bits int
+		set  func(n uint64)
+	}{
+		{"ARGON2_MEMORY_KIB", 32, func(n uint64) { p.Memory = uint32(n) }},
+		{"ARGON2_ITERATIONS", 32, func(n uint64) { p.Iterations = uint32(n) }},
+		{"ARGON2_PARALLELISM", 8, func(n uint64) { p.Parallelism = uint8(n) }},
+	} {
+		s := os.Getenv(setting.env)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(s, 10, setting.bits)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", setting.env, s)
+		}
+		setting.set(n)
+	}
+	return auth.SetArgon2Params(p)
+}
+
+// loadPasswordPolicy starts from password.DefaultPolicy and applies
+// PASSWORD_MIN_LENGTH, PASSWORD_MIN_SCORE, PASSWORD_REJECT_FILE and
+// PASSWORD_BREACHED_PATH.
+func loadPasswordPolicy() (*password.Policy, error) {
+	p := password.DefaultPolicy()
+	if s := os.Getenv("PASSWORD_MIN_LENGTH"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", s)
+		}
+		p.MinLength = n
+	}
+	if s := os.Getenv("PASSWORD_MIN_SCORE"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > 4 {
+			return nil, fmt.Errorf("invalid PASSWORD_MIN_SCORE %q", s)
+		}
+		p.MinScore = n
+	}
+	if path := os.Getenv("PASSWORD_REJECT_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		err = p.LoadRejectList(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if path := os.Getenv("PASSWORD_BREACHED_PATH"); path != "" {
+		corpus, err := password.OpenCorpus(path)
+		if err != nil {
+			return nil, err
+		}
+		p.Breached = corpus
+	}
+	return p, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+/*Stuff related to verifying email addresses*/
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/auth"
+	"example.com/username/bootdev-chirpy/internal/database"
+	"example.com/username/bootdev-chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const verificationExpiresIn = 48 * time.Hour
+
+// verificationPolicy decides what an account may do before its email
+// address is verified. It is set with EMAIL_VERIFICATION.
+type verificationPolicy string
+
+const (
+	// verifyOptional doesn't restrict unverified accounts at all.
+	verifyOptional verificationPolicy = "optional"
+	// verifyToPost lets unverified accounts log in and read, but not chirp.
+	verifyToPost verificationPolicy = "post"
+	// verifyToLogin refuses to log unverified accounts in.
+	verifyToLogin verificationPolicy = "login"
+)
+
+func parseVerificationPolicy(s string) (verificationPolicy, error) {
+	switch p := verificationPolicy(s); p {
+	case "":
+		return verifyOptional, nil
+	case verifyOptional, verifyToPost, verifyToLogin:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown email verification policy %q", s)
+}
+
+var errEmailNotVerified = errors.New("email address not verified")
+
+// requireVerifiedEmail returns errEmailNotVerified if the policy doesn't let
+// userID post until their email address is verified.
+func (cfg *apiConfig) requireVerifiedEmail(ctx context.Context, userID uuid.UUID) error {
+	if cfg.verification == verifyOptional {
+		return nil
+	}
+	user, err := cfg.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerifiedAt.Valid {
+		return errEmailNotVerified
+	}
+	return nil
+}
+
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	return cfg.sendEmailLink(ctx, user.ID, user.Email,
+		"Verify your Chirpy email address",
+		"Follow this link to verify your email address:",
+		"If you didn't sign up for Chirpy, you can ignore this email.")
+}
+
+// sendEmailChangeConfirmation mails a link to newEmail that makes it the
+// user's address once followed, and warns the current address.
+func (cfg *apiConfig) sendEmailChangeConfirmation(ctx context.Context, user database.User, newEmail string) error {
+	err := cfg.sendEmailLink(ctx, user.ID, newEmail,
+		"Confirm your new Chirpy email address",
+		"Follow this link to make this the email address of your Chirpy account:",
+		"If you didn't ask for this, you can ignore this email.")
+	if err != nil {
+		return err
+	}
+	cfg.sendMail(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy email address is being changed",
+		Body: "Someone asked to change the email address of your Chirpy account to " + newEmail +
+			". It will change once they follow the link sent there.\n\nIf this wasn't you, change your password now.\n",
+	})
+	return nil
+}
+
+func (cfg *apiConfig) sendEmailLink(ctx context.Context, userID uuid.UUID, email, subject, intro, outro string) error {
+	token, err := auth.MakeEmailJWT(userID, email, cfg.keys, verificationExpiresIn)
+	if err != nil {
+		return err
+	}
+	link := cfg.baseURL + "/api/users/verify?token=" + url.QueryEscape(token)
+	cfg.sendMail(ctx, mailer.Message{
+		To:      email,
+		Subject: subject,
+		Body:    intro + "\n\n" + link + "\n\nThe link expires in 48 hours. " + outro + "\n",
+	})
+	return nil
+}
+
+// verifyEmail is the target of the link in verification emails, which also
+// confirms changes of address.
+func (cfg *apiConfig) verifyEmail(w http.ResponseWriter, req *http.Request) {
+	userID, email, err := auth.ValidateEmailJWT(req.URL.Query().Get("token"), cfg.keys)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification link", err)
+		return
+	}
+	n, err := cfg.db.VerifyUserEmail(req.Context(), database.VerifyUserEmailParams{
+		ID:    userID,
+		Email: email,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email address", err)
+		return
+	}
+	if n == 0 {
+		n, err = cfg.db.ConfirmEmailChange(req.Context(), database.ConfirmEmailChangeParams{
+			ID:           userID,
+			PendingEmail: sql.NullString{String: email, Valid: true},
+		})
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, "Email already in use", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't change email address", err)
+			return
+		}
+	}
+	if n == 0 {
+		// Either the link was already used or the address has changed
+		// since it was sent.
+		user, err := cfg.db.GetUserByID(req.Context(), userID)
+		if err != nil || user.Email != email || !user.EmailVerifiedAt.Valid {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired verification link", err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resendVerification mails a new link to an unverified address. It answers
+// the same way whether or not the address belongs to an account.
+func (cfg *apiConfig) resendVerification(w http.ResponseWriter, req *http.Request) {
+	params := parameters{}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters", err)
+		return
+	}
+	user, err := cfg.db.GetUserByMail(req.Context(), params.Email)
+	if err == nil && !user.EmailVerifiedAt.Valid && !user.BannedAt.Valid {
+		err = cfg.sendVerificationEmail(req.Context(), user)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email", err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,215 @@
+package main
+
+/*Stuff related to the log of inbound webhook deliveries*/
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/username/bootdev-chirpy/internal/billing"
+	"example.com/username/bootdev-chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Events are stored as "received" and end up in one of these states.
+const (
+	webhookProcessed = "processed"
+	webhookIgnored   = "ignored"
+	webhookFailed    = "failed"
+
+	defaultWebhookListLimit = 50
+	maxWebhookListLimit     = 500
+
+	// webhookStaleAfter is how long an event may sit in "received" before
+	// we assume whatever was processing it died.
+	webhookStaleAfter = 10 * time.Minute
+)
+
+// errUnhandledEvent is returned for event types we accept but have nothing
+// to do for.
+var errUnhandledEvent = errors.New("unhandled event type")
+
+type WebhookEvent struct {
+	ID          uuid.UUID       `json:"id"`
+	Provider    string          `json:"provider"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int32           `json:"attempts"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+}
+
+func webhookEventFromDB(event database.WebhookEvent) WebhookEvent {
+	resp := WebhookEvent{
+		ID:        event.ID,
+		Provider:  event.Provider,
+		EventID:   event.EventID,
+		EventType: event.EventType,
+		Status:    event.Status,
+		Error:     event.Error.String,
+		Attempts:  event.Attempts,
+		Payload:   event.Payload,
+		CreatedAt: event.CreatedAt,
+	}
+	if event.ProcessedAt.Valid {
+		resp.ProcessedAt = &event.ProcessedAt.Time
+	}
+	return resp
+}
+
+// recordWebhookEvent stores a verified delivery. It reports false if the
+// event was already delivered and shouldn't be processed now; only events
+// that failed, or were left half done, are retried. The stored event is
+// returned either way, so callers can tell a finished event from one that
+// is still being processed.
+func (cfg *apiConfig) recordWebhookEvent(ctx context.Context, params database.CreateWebhookEventParams) (database.WebhookEvent, bool, error) {
+	event, err := cfg.db.CreateWebhookEvent(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		event, err = cfg.db.GetWebhookEventByEventID(ctx, database.GetWebhookEventByEventIDParams{
+			Provider: params.Provider,
+			EventID:  params.EventID,
+		})
+		if err != nil {
+			return database.WebhookEvent{}, false, err
+		}
+		claimed, ok, err := cfg.claimWebhookEvent(ctx, event.ID)
+		if err != nil || !ok {
+			return event, false, err
+		}
+		return claimed, true, nil
+	}
+	if err != nil {
+		return database.WebhookEvent{}, false, err
+	}
+	return event, true, nil
+}
+
+// claimWebhookEvent marks a failed event, or one stuck in "received" for
+// longer than webhookStaleAfter, as being processed again. It reports false
+// if the event can't be claimed, so concurrent retries apply it only once.
+func (cfg *apiConfig) claimWebhookEvent(ctx context.Context, id uuid.UUID) (database.WebhookEvent, bool, error) {
+	event, err := cfg.db.ClaimWebhookEvent(ctx, database.ClaimWebhookEventParams{
+		ID:          id,
+		StaleBefore: time.Now().UTC().Add(-webhookStaleAfter),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.WebhookEvent{}, false, nil
+	}
+	if err != nil {
+		return database.WebhookEvent{}, false, err
+	}
+	return event, true, nil
+}
+
+// processWebhookEvent applies a stored event and records how it went. The
+// error is the one from applying the event, so callers can pick a status
+// code; failing to record the outcome is only logged.
+func (cfg *apiConfig) processWebhookEvent(ctx context.Context, event database.WebhookEvent) error {
+	var err error
+	provider, ok := cfg.billing[event.Provider]
+	if !ok {
+		err = fmt.Errorf("payment provider %q isn't configured", event.Provider)
+	} else {
+		var parsed billing.Event
+		parsed, err = provider.Parse(nil, event.Payload)
+		if err == nil {
+			err = cfg.applySubscriptionEvent(ctx, event.Provider, parsed)
+		}
+	}
+
+	outcome := database.RecordWebhookOutcomeParams{ID: event.ID, Status: webhookProcessed}
+	switch {
+	case errors.Is(err, errUnhandledEvent):
+		outcome.Status = webhookIgnored
+		err = nil
+	case err != nil:
+		outcome.Status = webhookFailed
+		outcome.Error = sql.NullString{String: err.Error(), Valid: true}
+	}
+	if recErr := cfg.db.RecordWebhookOutcome(ctx, outcome); recErr != nil {
+		log.Printf("Couldn't record outcome of webhook event %s: %v", event.ID, recErr)
+	}
+	return err
+}
+
+// listWebhookEvents shows the newest deliveries first, optionally only
+// those with ?status=, up to ?limit= of them.
+func (cfg *apiConfig) listWebhookEvents(w http.ResponseWriter, req *http.Request) {
+	if !cfg.requireAdmin(w, req) {
+		return
+	}
+	params := database.ListWebhookEventsParams{RowLimit: defaultWebhookListLimit}
+	if status := req.URL.Query().Get("status"); status != "" {
+		params.Status = sql.NullString{String: status, Valid: true}
+	}
+	if s := req.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxWebhookListLimit {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxWebhookListLimit), err)
+			return
+		}
+		params.RowLimit = int32(n)
+	}
+	events, err := cfg.db.ListWebhookEvents(req.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list webhook events", err)
+		return
+	}
+	resp := []WebhookEvent{}
+	for _, event := range events {
+		resp = append(resp, webhookEventFromDB(event))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// replayWebhookEvent processes a failed or stuck event again, for when
+// whatever made it fail has been fixed.
+func (cfg *apiConfig) replayWebhookEvent(w http.ResponseWriter, req *http.Request) {
+	if !cfg.requireAdmin(w, req) {
+		return
+	}
+	id, err := uuid.Parse(req.PathValue("eventID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid event ID", err)
+		return
+	}
+	event, err := cfg.db.GetWebhookEvent(req.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Webhook event not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhook event", err)
+		return
+	}
+	event, ok, err := cfg.claimWebhookEvent(req.Context(), event.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't claim webhook event", err)
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusConflict, "Only failed or stuck events can be replayed", nil)
+		return
+	}
+
+	err = cfg.processWebhookEvent(req.Context(), event)
+	if err != nil {
+		log.Printf("Replay of webhook event %s failed: %v", event.ID, err)
+	}
+	event, err = cfg.db.GetWebhookEvent(req.Context(), id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhook event", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, webhookEventFromDB(event))
+}
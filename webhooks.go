@@ -1,52 +1,209 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"example.com/username/bootdev-chirpy/internal/auth"
+	"example.com/username/bootdev-chirpy/internal/billing"
+	"example.com/username/bootdev-chirpy/internal/database"
+	"example.com/username/bootdev-chirpy/internal/entitlements"
 	"github.com/google/uuid"
 )
 
-const upgradeEvent string = "user.upgraded"
+const (
+	defaultWebhookTolerance = 5 * time.Minute
+	maxWebhookSize          = 1 << 20
+)
 
-type WebhookParams struct {
-	Event string `json:"event"`
-	Data  struct {
-		UserID uuid.UUID `json:"user_id"`
-	} `json:"data"`
-}
+var (
+	errUnknownSubscriber = errors.New("unknown user")
+	// errOtherProvider is returned when a provider tries to take over a
+	// subscription another provider is still billing.
+	errOtherProvider = errors.New("user has an active subscription with another provider")
+	// errUnknownPlan is returned for activations of plans that aren't in the
+	// entitlements table, which would otherwise grant nothing.
+	errUnknownPlan = errors.New("unknown plan")
+)
 
-func (cfg *apiConfig) upgradeUser(w http.ResponseWriter, req *http.Request) {
-	header, err := auth.GetAPIKey(req.Header)
+// loadBillingProviders sets up the payment providers whose webhooks we
+// accept, by name. Polka is always there; the Stripe-style provider only
+// once STRIPE_WEBHOOK_SECRETS is set, and its default plan must be in plans.
+func loadBillingProviders(plans entitlements.Table) (map[string]billing.Provider, error) {
+	polka, err := loadWebhookVerifier("POLKA", os.Getenv("POLKA_KEY"))
 	if err != nil {
-		w.WriteHeader(401)
-		w.Write([]byte("Error fetching API Key"))
-		return
+		return nil, err
+	}
+	if len(polka.Secrets) == 0 {
+		log.Println("POLKA_WEBHOOK_SECRETS not set, rejecting all Polka webhooks")
 	}
-	if header != cfg.polkaKey {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("wrong API Key"))
-		return
+	providers := []billing.Provider{
+		&billing.Polka{Verifier: polka, Plan: planChirpyRed},
 	}
 
-	decoder := json.NewDecoder(req.Body)
-	params := WebhookParams{}
-	err = decoder.Decode(&params)
+	stripe, err := loadWebhookVerifier("STRIPE", "")
 	if err != nil {
-		w.WriteHeader(500)
-		w.Write([]byte("Error decoding parameters"))
-		return
+		return nil, err
 	}
-	if params.Event != upgradeEvent {
-		w.WriteHeader(http.StatusNoContent)
-		return
-	} else {
-		_, err := cfg.db.UpgradeUser(req.Context(), params.Data.UserID)
+	if len(stripe.Secrets) > 0 {
+		plan := os.Getenv("STRIPE_DEFAULT_PLAN")
+		if plan == "" {
+			plan = planChirpyRed
+		}
+		if _, ok := plans[plan]; !ok || plan == entitlements.Free {
+			return nil, fmt.Errorf("unknown STRIPE_DEFAULT_PLAN %q", plan)
+		}
+		providers = append(providers, &billing.Stripe{Verifier: stripe, DefaultPlan: plan})
+	}
+
+	byName := map[string]billing.Provider{}
+	for _, p := range providers {
+		byName[p.Name()] = p
+	}
+	return byName, nil
+}
+
+// loadWebhookVerifier reads <prefix>_WEBHOOK_SECRETS, a comma-separated
+// list of secrets the provider may sign with, falling back to fallback,
+// and <prefix>_WEBHOOK_TOLERANCE, a Go duration.
+func loadWebhookVerifier(prefix, fallback string) (auth.WebhookVerifier, error) {
+	v := auth.WebhookVerifier{Tolerance: defaultWebhookTolerance}
+	secrets := os.Getenv(prefix + "_WEBHOOK_SECRETS")
+	if secrets == "" {
+		secrets = fallback
+	}
+	for secret := range strings.SplitSeq(secrets, ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			v.Secrets = append(v.Secrets, []byte(secret))
+		}
+	}
+	if s := os.Getenv(prefix + "_WEBHOOK_TOLERANCE"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return v, fmt.Errorf("invalid %s_WEBHOOK_TOLERANCE %q", prefix, s)
+		}
+		v.Tolerance = d
+	}
+	return v, nil
+}
+
+// billingWebhook handles deliveries from one payment provider. Each is
+// recorded before it is applied, and repeats are only applied again if
+// the first attempt failed. A repeat that arrives while the first attempt
+// is still running gets a 409 so the provider retries it.
+func (cfg *apiConfig) billingWebhook(provider billing.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxWebhookSize))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't read body", err)
+			return
+		}
+		err = provider.Verify(req.Header, body, time.Now())
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Invalid signature", err)
+			return
+		}
+		event, err := provider.Parse(req.Header, body)
 		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+			return
+		}
+
+		stored, process, err := cfg.recordWebhookEvent(req.Context(), database.CreateWebhookEventParams{
+			Provider:  provider.Name(),
+			EventID:   event.ID,
+			EventType: event.ProviderType,
+			Payload:   body,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't record event", err)
+			return
+		}
+		if !process {
+			if stored.Status == webhookProcessed || stored.Status == webhookIgnored {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			// The first delivery may still fail, so have the provider try
+			// again later rather than think this one went through.
+			respondWithError(w, http.StatusConflict, "Event is still being processed", nil)
+			return
+		}
+
+		err = cfg.processWebhookEvent(req.Context(), stored)
+		if errors.Is(err, errUnknownSubscriber) {
+			respondWithError(w, http.StatusNotFound, "User not found", err)
+			return
+		}
+		if errors.Is(err, errOtherProvider) {
+			respondWithError(w, http.StatusConflict, "Subscription belongs to another provider", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update subscription", err)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+// applySubscriptionEvent moves the user's subscription along its
+// lifecycle. Events that don't affect subscriptions return
+// errUnhandledEvent.
+func (cfg *apiConfig) applySubscriptionEvent(ctx context.Context, provider string, event billing.Event) error {
+	if event.Type == "" {
+		return errUnhandledEvent
+	}
+	if event.UserID == uuid.Nil {
+		return errUnknownSubscriber
+	}
+	switch event.Type {
+	case billing.EventActivated, billing.EventRenewed:
+		if _, ok := cfg.entitlements[event.Plan]; !ok || event.Plan == entitlements.Free {
+			return fmt.Errorf("%w %q", errUnknownPlan, event.Plan)
+		}
+		sub := database.UpsertSubscriptionParams{
+			UserID:   event.UserID,
+			Plan:     event.Plan,
+			Status:   subscriptionActive,
+			Provider: provider,
+		}
+		if !event.CurrentPeriodEnd.IsZero() {
+			sub.CurrentPeriodEnd.Time = event.CurrentPeriodEnd
+			sub.CurrentPeriodEnd.Valid = true
+		}
+		if event.SubscriptionRef != "" {
+			sub.ProviderRef.String = event.SubscriptionRef
+			sub.ProviderRef.Valid = true
+		}
+		_, err := cfg.db.UpsertSubscription(ctx, sub)
+		if isForeignKeyViolation(err) {
+			return errUnknownSubscriber
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return errOtherProvider
+		}
+		return err
+	case billing.EventPaymentFailed:
+		return cfg.db.SetSubscriptionStatus(ctx, database.SetSubscriptionStatusParams{
+			UserID:   event.UserID,
+			Status:   subscriptionPastDue,
+			Provider: provider,
+		})
+	case billing.EventCanceled:
+		return cfg.db.SetSubscriptionStatus(ctx, database.SetSubscriptionStatusParams{
+			UserID:   event.UserID,
+			Status:   subscriptionCanceled,
+			Provider: provider,
+		})
+	}
+	return errUnhandledEvent
+}